@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// churnConfig controls the connection churn tester.
+type churnConfig struct {
+	Addrs          []string
+	Rate           float64
+	Duration       time.Duration
+	Hold           time.Duration
+	ConnectTimeout time.Duration
+	StallThreshold time.Duration
+	ReportInterval time.Duration
+	Request        bool
+}
+
+func loadChurnConfig() (churnConfig, error) {
+	var c churnConfig
+	addr := os.Getenv("TARGET_ADDR")
+	if addr == "" {
+		return c, errors.New("TARGET_ADDR environment variable is required (host:port)")
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return c, fmt.Errorf("TARGET_ADDR: %v", err)
+	}
+	ports := []string{port}
+	if v := os.Getenv("CHURN_PORTS"); v != "" {
+		if ports, err = parsePorts(v); err != nil {
+			return c, fmt.Errorf("CHURN_PORTS: %v", err)
+		}
+	}
+	for _, p := range ports {
+		c.Addrs = append(c.Addrs, net.JoinHostPort(host, p))
+	}
+
+	if c.Rate, err = strconv.ParseFloat(envOr("CHURN_RATE", "50"), 64); err != nil || c.Rate <= 0 {
+		return c, fmt.Errorf("CHURN_RATE must be a positive number")
+	}
+	if c.Duration, err = envDuration("CHURN_DURATION", time.Minute); err != nil {
+		return c, err
+	}
+	if c.Hold, err = envDuration("CHURN_HOLD", 0); err != nil {
+		return c, err
+	}
+	if c.ConnectTimeout, err = envDuration("CHURN_CONNECT_TIMEOUT", 5*time.Second); err != nil {
+		return c, err
+	}
+	if c.StallThreshold, err = envDuration("CHURN_STALL_THRESHOLD", time.Second); err != nil {
+		return c, err
+	}
+	if c.ReportInterval, err = envDuration("CHURN_REPORT_INTERVAL", 5*time.Second); err != nil {
+		return c, err
+	}
+	if c.Request, err = strconv.ParseBool(envOr("CHURN_REQUEST", "true")); err != nil {
+		return c, fmt.Errorf("CHURN_REQUEST: %v", err)
+	}
+	return c, nil
+}
+
+// parsePorts expands "80,8000-8003" into individual ports.
+func parsePorts(spec string) ([]string, error) {
+	var ports []string
+	for _, part := range strings.Split(spec, ",") {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		from, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, err
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(hi); err != nil {
+				return nil, err
+			}
+		}
+		if from < 1 || to > 65535 || from > to {
+			return nil, fmt.Errorf("invalid port range %q", part)
+		}
+		for p := from; p <= to; p++ {
+			ports = append(ports, strconv.Itoa(p))
+		}
+	}
+	return ports, nil
+}
+
+// churnWindow counts connection outcomes over one reporting interval (or
+// the whole run for the final summary).
+type churnWindow struct {
+	Attempted int64 `json:"attempted"`
+	Connected int64 `json:"connected"`
+	// Refused connects still crossed NAT and the VPN (the RST came back),
+	// so probing closed hub ports counts them apart from failures.
+	Refused  int64            `json:"refused"`
+	Stalled  int64            `json:"stalled"`
+	Failed   int64            `json:"failed"`
+	Failures map[string]int64 `json:"failures,omitempty"`
+	hist     *hdrhistogram.Histogram
+}
+
+func newChurnWindow() *churnWindow {
+	return &churnWindow{Failures: map[string]int64{}, hist: hdrhistogram.New(histMin, histMax, histSigFigs)}
+}
+
+// churnEvent marks the first time connects failed or stalled, with the
+// state of the run at that moment.
+type churnEvent struct {
+	AtSeconds float64 `json:"at_seconds"`
+	Attempted int64   `json:"attempted"`
+	Open      int64   `json:"open"`
+	Class     string  `json:"class,omitempty"`
+}
+
+type churnRun struct {
+	cfg   churnConfig
+	start time.Time
+	open  atomic.Int64
+
+	mu           sync.Mutex
+	window       *churnWindow
+	total        *churnWindow
+	maxOpen      int64
+	firstFailure *churnEvent
+	firstStall   *churnEvent
+}
+
+// runChurn opens new TCP connections to TARGET_ADDR (or each port in
+// CHURN_PORTS, round-robin) at CHURN_RATE per second without reuse. Each
+// carries at most one HTTP request, is held for CHURN_HOLD, then closed by
+// the job so TIME_WAIT lands on the spoke side. It
+// reports when connects first fail or stall, which is where Private NAT runs
+// out of ports for the spoke.
+func runChurn() error {
+	cfg, err := loadChurnConfig()
+	if err != nil {
+		return err
+	}
+	run := &churnRun{cfg: cfg, start: time.Now(), window: newChurnWindow(), total: newChurnWindow()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Duration)
+	defer cancel()
+
+	slog.Info("Churn started", "addrs", len(cfg.Addrs), "rate", cfg.Rate,
+		"hold", cfg.Hold.String(), "duration", cfg.Duration.String())
+
+	var wg sync.WaitGroup
+	interval := time.Duration(float64(time.Second) / cfg.Rate)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	report := time.NewTicker(cfg.ReportInterval)
+	defer report.Stop()
+
+	for n := 0; ; n++ {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			run.flush("Churn summary", run.total)
+			if run.firstFailure != nil {
+				return fmt.Errorf("connects started failing after %.1fs (%d attempted, %d open)",
+					run.firstFailure.AtSeconds, run.firstFailure.Attempted, run.firstFailure.Open)
+			}
+			return nil
+		case <-report.C:
+			run.mu.Lock()
+			w := run.window
+			run.window = newChurnWindow()
+			run.mu.Unlock()
+			run.flush("Churn interval", w)
+		case <-ticker.C:
+			addr := cfg.Addrs[n%len(cfg.Addrs)]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				run.connect(addr)
+			}()
+		}
+	}
+}
+
+func (run *churnRun) connect(addr string) {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr, run.cfg.ConnectTimeout)
+	latency := time.Since(start)
+	if err != nil {
+		run.record(latency, classifyError(err))
+		return
+	}
+	open := run.open.Add(1)
+	defer run.open.Add(-1)
+	run.record(latency, "")
+	run.mu.Lock()
+	run.maxOpen = max(run.maxOpen, open)
+	run.mu.Unlock()
+
+	if run.cfg.Request {
+		conn.SetDeadline(time.Now().Add(run.cfg.ConnectTimeout + run.cfg.Hold))
+		host, _, _ := net.SplitHostPort(addr)
+		fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: %s\r\n\r\n", host)
+		if resp, err := http.ReadResponse(bufio.NewReader(conn), nil); err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}
+	if run.cfg.Hold > 0 {
+		time.Sleep(run.cfg.Hold)
+	}
+	conn.Close()
+}
+
+func (run *churnRun) record(latency time.Duration, class string) {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	stalled := class == "" && latency >= run.cfg.StallThreshold
+	for _, w := range []*churnWindow{run.window, run.total} {
+		w.Attempted++
+		if class == classConnectRefused {
+			w.Refused++
+			continue
+		}
+		if class != "" {
+			w.Failed++
+			w.Failures[class]++
+			continue
+		}
+		w.Connected++
+		w.hist.RecordValue(max(histMin, min(histMax, latency.Microseconds())))
+		if stalled {
+			w.Stalled++
+		}
+	}
+	event := func() *churnEvent {
+		return &churnEvent{
+			AtSeconds: time.Since(run.start).Seconds(),
+			Attempted: run.total.Attempted,
+			Open:      run.open.Load(),
+			Class:     class,
+		}
+	}
+	if class != "" && class != classConnectRefused && run.firstFailure == nil {
+		run.firstFailure = event()
+		slog.Warn("First connect failure", "event", run.firstFailure)
+	}
+	if stalled && run.firstStall == nil {
+		run.firstStall = event()
+		slog.Warn("First connect stall", "event", run.firstStall, "connectSeconds", latency.Seconds())
+	}
+}
+
+func (run *churnRun) flush(msg string, w *churnWindow) {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	slog.Info(msg,
+		"elapsedSeconds", time.Since(run.start).Seconds(),
+		"open", run.open.Load(),
+		"maxOpen", run.maxOpen,
+		"counts", w,
+		"connectLatency", summarise(w.hist),
+		"firstFailure", run.firstFailure,
+		"firstStall", run.firstStall)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParsePorts(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []string
+		wantErr bool
+	}{
+		{spec: "80", want: []string{"80"}},
+		{spec: "80,8000-8003", want: []string{"80", "8000", "8001", "8002", "8003"}},
+		{spec: " 80 , 443 ", want: []string{"80", "443"}},
+		{spec: "9-9", want: []string{"9"}},
+		{spec: "1,65535", want: []string{"1", "65535"}},
+		{spec: "", wantErr: true},
+		{spec: "80,", wantErr: true},
+		{spec: "http", wantErr: true},
+		{spec: "0", wantErr: true},
+		{spec: "65536", wantErr: true},
+		{spec: "8003-8000", wantErr: true},
+		{spec: "8000-", wantErr: true},
+		{spec: "-80", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parsePorts(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parsePorts(%q) = %v, want error", tt.spec, got)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("parsePorts(%q) = %v, %v, want %v", tt.spec, got, err, tt.want)
+		}
+	}
+}
+
+func TestLoadChurnConfigRequest(t *testing.T) {
+	t.Setenv("TARGET_ADDR", "10.0.0.2:80")
+	for v, want := range map[string]bool{"": true, "true": true, "1": true, "TRUE": true, "false": false, "0": false} {
+		t.Setenv("CHURN_REQUEST", v)
+		c, err := loadChurnConfig()
+		if err != nil || c.Request != want {
+			t.Errorf("CHURN_REQUEST=%q: request %v, %v, want %v", v, c.Request, err, want)
+		}
+	}
+	t.Setenv("CHURN_REQUEST", "yes")
+	if _, err := loadChurnConfig(); err == nil {
+		t.Error(`CHURN_REQUEST="yes": want error`)
+	}
+}
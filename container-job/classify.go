@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// Failure classes reported in results. The first five separate "the path
+// isn't there yet" (DNS, routing, NAT) from "the path works but the answer
+// is wrong".
+const (
+	classDNS            = "dns"
+	classDNSMismatch    = "dns_mismatch"
+	classConnectRefused = "connect_refused"
+	classConnectTimeout = "connect_timeout"
+	classTLS            = "tls"
+	classProxy          = "proxy"
+	classHTTPStatus     = "http_status"
+	classBodyMismatch   = "body_mismatch"
+	classSourceMismatch = "source_mismatch"
+	classWrongService   = "wrong_service"
+	classReset          = "reset"
+	classTimeout        = "timeout"
+	classUnexpected     = "unexpected_response"
+	classLocalPorts     = "local_ports_exhausted"
+	classOther          = "other"
+)
+
+// classifyError maps a transport error from http.Client.Do (or a raw dial)
+// to a failure class.
+func classifyError(err error) string {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var unknownCA x509.UnknownAuthorityError
+	var hostErr x509.HostnameError
+	var invalidCert x509.CertificateInvalidError
+	var proxyErr *proxyConnectError
+
+	switch {
+	case errors.As(err, &proxyErr), errors.As(err, &opErr) && opErr.Op == "proxyconnect":
+		return classProxy
+	case errors.As(err, &dnsErr):
+		return classDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return classConnectRefused
+	case errors.Is(err, syscall.EADDRNOTAVAIL):
+		return classLocalPorts
+	case errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout():
+		return classConnectTimeout
+	case errors.As(err, &certErr), errors.As(err, &recordErr), errors.As(err, &alertErr),
+		errors.As(err, &unknownCA), errors.As(err, &hostErr), errors.As(err, &invalidCert),
+		strings.Contains(err.Error(), "server gave HTTP response to HTTPS client"):
+		return classTLS
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return classReset
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, syscall.ETIMEDOUT):
+		return classTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return classTimeout
+	}
+	return classOther
+}
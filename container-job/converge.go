@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// convergence reports how long a target took to become reachable and how
+// stable it stayed afterwards.
+type convergence struct {
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	Converged bool   `json:"converged"`
+	// TimeToFirstSuccessSeconds is measured from CONVERGE_SINCE when set
+	// (e.g. the moment setup-connectivity.sh finished), else from job start.
+	TimeToFirstSuccessSeconds float64        `json:"time_to_first_success_seconds,omitempty"`
+	AttemptsBeforeSuccess     int            `json:"attempts_before_success"`
+	FailureClasses            map[string]int `json:"failure_classes,omitempty"`
+	Stability                 *stability     `json:"stability,omitempty"`
+}
+
+// stability summarises polling during the window after the first success.
+type stability struct {
+	WindowSeconds        float64        `json:"window_seconds"`
+	Probes               int            `json:"probes"`
+	Failures             int            `json:"failures"`
+	SuccessRatio         float64        `json:"success_ratio"`
+	LongestFailureStreak int            `json:"longest_failure_streak"`
+	FailureClasses       map[string]int `json:"failure_classes,omitempty"`
+}
+
+// runConverge polls every target in parallel until its first success or
+// CONVERGE_DEADLINE, then keeps polling for STABILITY_WINDOW. Each poll
+// gives up after CONVERGE_ATTEMPT_TIMEOUT rather than the target's own
+// timeout, so a blackholed path is retried every few seconds and the time
+// to first success stays accurate. It fails if any target never converged.
+func runConverge() error {
+	targets, err := loadTargets()
+	if err != nil {
+		return err
+	}
+	if targets = task.targets(targets); len(targets) == 0 {
+		slog.Info("No targets for this shard")
+		return nil
+	}
+	deadline, err := envDuration("CONVERGE_DEADLINE", 5*time.Minute)
+	if err != nil {
+		return err
+	}
+	interval, err := envDuration("POLL_INTERVAL", time.Second)
+	if err != nil {
+		return err
+	}
+	window, err := envDuration("STABILITY_WINDOW", 30*time.Second)
+	if err != nil {
+		return err
+	}
+	attemptTimeout, err := envDuration("CONVERGE_ATTEMPT_TIMEOUT", 2*time.Second)
+	if err != nil {
+		return err
+	}
+	if attemptTimeout <= 0 {
+		return fmt.Errorf("CONVERGE_ATTEMPT_TIMEOUT must be positive")
+	}
+	since := time.Now()
+	if v := os.Getenv("CONVERGE_SINCE"); v != "" {
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			return fmt.Errorf("CONVERGE_SINCE: %v", err)
+		}
+	}
+
+	tr, err := newTransport()
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Transport: tracedTransport(tr)}
+	results := make([]convergence, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		t.Timeout = attemptTimeout
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = converge(context.Background(), client, t, since, deadline, interval, window)
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, c := range results {
+		level := slog.LevelInfo
+		if !c.Converged {
+			level = slog.LevelError
+			failed++
+		}
+		slog.Log(context.Background(), level, "Convergence result", "result", c)
+		o := outcome{Name: c.Name, OK: c.Converged, Seconds: c.TimeToFirstSuccessSeconds, Result: c}
+		if !c.Converged {
+			o.Class, o.Message = classTimeout, fmt.Sprintf("did not converge within %s", deadline)
+		}
+		record(o)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d targets did not converge within %s", failed, len(targets), deadline)
+	}
+	return nil
+}
+
+func converge(ctx context.Context, client *http.Client, t target, since time.Time, deadline, interval, window time.Duration) convergence {
+	c := convergence{Name: t.Name, URL: t.URL, FailureClasses: map[string]int{}}
+	log := slog.With("name", t.Name)
+
+	ctx, cancel := context.WithDeadline(ctx, time.Now().Add(deadline))
+	defer cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for !c.Converged {
+		r := attempt(ctx, client, t)
+		if r.OK {
+			c.Converged = true
+			c.TimeToFirstSuccessSeconds = time.Since(since).Seconds()
+			log.Info("Target converged", "seconds", c.TimeToFirstSuccessSeconds, "attempts", c.AttemptsBeforeSuccess+1)
+			break
+		}
+		c.AttemptsBeforeSuccess++
+		c.FailureClasses[r.ErrorClass]++
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return c
+		}
+	}
+
+	st := &stability{WindowSeconds: window.Seconds(), FailureClasses: map[string]int{}}
+	end := time.Now().Add(window)
+	streak := 0
+	for time.Now().Before(end) {
+		<-ticker.C
+		r := attempt(context.Background(), client, t)
+		st.Probes++
+		if r.OK {
+			streak = 0
+			continue
+		}
+		st.Failures++
+		st.FailureClasses[r.ErrorClass]++
+		streak++
+		st.LongestFailureStreak = max(st.LongestFailureStreak, streak)
+	}
+	if st.Probes > 0 {
+		st.SuccessRatio = float64(st.Probes-st.Failures) / float64(st.Probes)
+	}
+	c.Stability = st
+	return c
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsQuery is one name to resolve. DNS_QUERIES (inline) or
+// DNS_QUERIES_FILE hold a JSON or YAML list of these.
+type dnsQuery struct {
+	Name string `yaml:"name"`
+	// ExpectIPs, when set, must equal the A and AAAA addresses returned
+	// (in any order), e.g. the ILB forwarding-rule address.
+	ExpectIPs []string `yaml:"expect_ips"`
+}
+
+// dnsResult is the outcome of resolving one name against one resolver.
+type dnsResult struct {
+	Name       string   `json:"name"`
+	Resolver   string   `json:"resolver"`
+	OK         bool     `json:"ok"`
+	ErrorClass string   `json:"error_class,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	Failures   []string `json:"failures,omitempty"`
+	// Addresses are the A and AAAA answers for Name, after any CNAMEs.
+	Addresses []string         `json:"addresses,omitempty"`
+	Lookups   []dnsLookupTrace `json:"lookups"`
+}
+
+// dnsLookupTrace is one query (A or AAAA) and its answer section.
+type dnsLookupTrace struct {
+	Type           string      `json:"type"`
+	Rcode          string      `json:"rcode"`
+	LatencySeconds float64     `json:"latency_seconds"`
+	Truncated      bool        `json:"truncated,omitempty"`
+	Answers        []dnsAnswer `json:"answers,omitempty"`
+}
+
+type dnsAnswer struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	TTL  uint32 `json:"ttl"`
+	Data string `json:"data"`
+}
+
+// runDNS resolves every name in DNS_QUERIES against the resolver in
+// /etc/resolv.conf and, if DNS_RESOLVER is set, against that one too. It
+// queries the servers directly rather than through the Go resolver, so
+// TTLs and CNAME chains are visible, and fails if any name did not resolve
+// or did not match its expected addresses.
+func runDNS() error {
+	queries, err := loadDNSQueries()
+	if err != nil {
+		return err
+	}
+	timeout, err := envDuration("TIMEOUT", 5*time.Second)
+	if err != nil {
+		return err
+	}
+
+	var resolvers []string
+	if def, err := systemResolver("/etc/resolv.conf"); err != nil {
+		slog.Warn("No system resolver", "error", err.Error())
+	} else {
+		resolvers = append(resolvers, def)
+	}
+	if v := os.Getenv("DNS_RESOLVER"); v != "" {
+		if _, _, err := net.SplitHostPort(v); err != nil {
+			v = net.JoinHostPort(v, "53")
+		}
+		resolvers = append(resolvers, v)
+	}
+	if len(resolvers) == 0 {
+		return errors.New("no resolver: /etc/resolv.conf has no nameserver and DNS_RESOLVER is unset")
+	}
+
+	total, failed := 0, 0
+	for _, q := range queries {
+		for _, server := range resolvers {
+			r := resolve(server, q, timeout)
+			total++
+			level := slog.LevelInfo
+			if !r.OK {
+				level = slog.LevelError
+				failed++
+			}
+			slog.Log(context.Background(), level, "DNS result", "result", r)
+			msg := r.Error
+			if msg == "" {
+				msg = strings.Join(r.Failures, "; ")
+			}
+			var seconds float64
+			for _, l := range r.Lookups {
+				seconds += l.LatencySeconds
+			}
+			record(outcome{Name: q.Name + " @" + server, OK: r.OK, Class: r.ErrorClass, Message: msg, Seconds: seconds, Result: r})
+		}
+	}
+
+	slog.Info("DNS summary", "total", total, "passed", total-failed, "failed", failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d lookups failed", failed, total)
+	}
+	return nil
+}
+
+func loadDNSQueries() ([]dnsQuery, error) {
+	queries, err := loadList[dnsQuery]("DNS_QUERIES", "DNS_QUERIES_FILE")
+	if err != nil {
+		return nil, err
+	}
+	for i, q := range queries {
+		if q.Name == "" {
+			return nil, fmt.Errorf("DNS query %d: name is required", i)
+		}
+		for _, ip := range q.ExpectIPs {
+			if _, err := netip.ParseAddr(ip); err != nil {
+				return nil, fmt.Errorf("DNS query %q: expect_ips: %v", q.Name, err)
+			}
+		}
+	}
+	return queries, nil
+}
+
+// systemResolver returns the first nameserver in a resolv.conf file.
+func systemResolver(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53"), nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no nameserver in %s", path)
+}
+
+// resolve looks up q's A and AAAA records at server and checks the
+// addresses against q.ExpectIPs. Names are queried as given, without
+// resolv.conf search domains; a trailing dot is optional.
+func resolve(server string, q dnsQuery, timeout time.Duration) dnsResult {
+	r := dnsResult{Name: q.Name, Resolver: server}
+	fqdn := q.Name
+	if !strings.HasSuffix(fqdn, ".") {
+		fqdn += "."
+	}
+	name, err := dnsmessage.NewName(fqdn)
+	if err != nil {
+		r.Error, r.ErrorClass = err.Error(), classOther
+		return r
+	}
+
+	var rcodes []string
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		start := time.Now()
+		msg, truncated, err := exchange(server, name, qtype, timeout)
+		l := dnsLookupTrace{Type: typeName(qtype), LatencySeconds: time.Since(start).Seconds(), Truncated: truncated}
+		if err != nil {
+			r.Error, r.ErrorClass = err.Error(), classifyError(err)
+			r.Lookups = append(r.Lookups, l)
+			return r
+		}
+		l.Rcode = rcodeName(msg.Header.RCode)
+		if l.Rcode != "NOERROR" && !slices.Contains(rcodes, l.Rcode) {
+			rcodes = append(rcodes, l.Rcode)
+		}
+		for _, a := range msg.Answers {
+			ans := dnsAnswer{Name: a.Header.Name.String(), Type: typeName(a.Header.Type), TTL: a.Header.TTL}
+			switch b := a.Body.(type) {
+			case *dnsmessage.AResource:
+				ans.Data = netip.AddrFrom4(b.A).String()
+				r.Addresses = append(r.Addresses, ans.Data)
+			case *dnsmessage.AAAAResource:
+				ans.Data = netip.AddrFrom16(b.AAAA).String()
+				r.Addresses = append(r.Addresses, ans.Data)
+			case *dnsmessage.CNAMEResource:
+				ans.Data = b.CNAME.String()
+			default:
+				ans.Data = b.GoString()
+			}
+			l.Answers = append(l.Answers, ans)
+		}
+		r.Lookups = append(r.Lookups, l)
+	}
+
+	switch {
+	case len(rcodes) > 0:
+		r.Failures, r.ErrorClass = []string{"rcode " + strings.Join(rcodes, ", ")}, classDNS
+	case len(r.Addresses) == 0:
+		r.Failures, r.ErrorClass = []string{"no A or AAAA records"}, classDNS
+	case len(q.ExpectIPs) > 0 && !sameAddrs(r.Addresses, q.ExpectIPs):
+		r.Failures = []string{fmt.Sprintf("addresses %v, want %v", r.Addresses, q.ExpectIPs)}
+		r.ErrorClass = classDNSMismatch
+	}
+	r.OK = len(r.Failures) == 0
+	return r
+}
+
+// exchange sends one recursive query over UDP, retrying over TCP when the
+// answer is truncated.
+func exchange(server string, name dnsmessage.Name, qtype dnsmessage.Type, timeout time.Duration) (*dnsmessage.Message, bool, error) {
+	var id [2]byte
+	rand.Read(id[:])
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: binary.BigEndian.Uint16(id[:]), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, false, err
+	}
+
+	msg, err := roundTrip("udp", server, packed, timeout)
+	if err != nil {
+		return nil, false, err
+	}
+	if !msg.Header.Truncated {
+		return msg, false, checkID(msg, query.Header.ID)
+	}
+	msg, err = roundTrip("tcp", server, packed, timeout)
+	if err != nil {
+		return nil, true, err
+	}
+	return msg, true, checkID(msg, query.Header.ID)
+}
+
+func roundTrip(network, server string, packed []byte, timeout time.Duration) (*dnsmessage.Message, error) {
+	conn, err := net.DialTimeout(network, server, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	var reply []byte
+	if network == "tcp" {
+		// DNS over TCP prefixes each message with its 2-byte length.
+		if _, err := conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(packed)))); err != nil {
+			return nil, err
+		}
+		if _, err := conn.Write(packed); err != nil {
+			return nil, err
+		}
+		var n [2]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return nil, err
+		}
+		reply = make([]byte, binary.BigEndian.Uint16(n[:]))
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(packed); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, 65535)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		reply = buf[:n]
+	}
+
+	var msg dnsmessage.Message
+	if err := msg.Unpack(reply); err != nil {
+		return nil, fmt.Errorf("malformed DNS reply: %v", err)
+	}
+	return &msg, nil
+}
+
+func checkID(msg *dnsmessage.Message, id uint16) error {
+	if msg.Header.ID != id {
+		return fmt.Errorf("DNS reply ID %d does not match query ID %d", msg.Header.ID, id)
+	}
+	return nil
+}
+
+func sameAddrs(got, want []string) bool {
+	norm := func(ips []string) []string {
+		var out []string
+		for _, s := range ips {
+			if ip, err := netip.ParseAddr(s); err == nil {
+				s = ip.Unmap().String()
+			}
+			out = append(out, s)
+		}
+		slices.Sort(out)
+		return slices.Compact(out)
+	}
+	return slices.Equal(norm(got), norm(want))
+}
+
+func typeName(t dnsmessage.Type) string {
+	return strings.TrimPrefix(t.String(), "Type")
+}
+
+func rcodeName(rc dnsmessage.RCode) string {
+	switch rc {
+	case dnsmessage.RCodeSuccess:
+		return "NOERROR"
+	case dnsmessage.RCodeFormatError:
+		return "FORMERR"
+	case dnsmessage.RCodeServerFailure:
+		return "SERVFAIL"
+	case dnsmessage.RCodeNameError:
+		return "NXDOMAIN"
+	case dnsmessage.RCodeNotImplemented:
+		return "NOTIMP"
+	case dnsmessage.RCodeRefused:
+		return "REFUSED"
+	}
+	return rc.String()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+)
+
+// echoReply is the part of the service's /echo response (schema v1) the
+// job checks.
+type echoReply struct {
+	SchemaVersion string `json:"schema_version"`
+	Instance      struct {
+		Hostname string `json:"hostname"`
+		Service  string `json:"service"`
+		Revision string `json:"revision"`
+	} `json:"instance"`
+	Source struct {
+		Client struct {
+			IP    string `json:"ip"`
+			Range string `json:"range"`
+		} `json:"client"`
+	} `json:"source"`
+}
+
+func parseEcho(body []byte) (*echoReply, error) {
+	var e echoReply
+	if err := json.Unmarshal(body, &e); err != nil {
+		return nil, err
+	}
+	if e.SchemaVersion == "" {
+		return nil, errors.New("not an echo reply")
+	}
+	return &e, nil
+}
+
+// checkSource returns a failure message unless body is an echo reply whose
+// client IP falls inside want.
+func checkSource(want netip.Prefix, body []byte) string {
+	e, err := parseEcho(body)
+	if err != nil {
+		return fmt.Sprintf("cannot read source IP: %v", err)
+	}
+	ip, err := netip.ParseAddr(e.Source.Client.IP)
+	if err != nil {
+		return fmt.Sprintf("cannot read source IP: %v", err)
+	}
+	if !want.Contains(ip.Unmap()) {
+		return fmt.Sprintf("source %s (%s) is outside %s", ip, e.Source.Client.Range, want)
+	}
+	return ""
+}
+
+// checkService returns a failure message unless body is an echo reply from
+// the Cloud Run service want.
+func checkService(want string, body []byte) string {
+	e, err := parseEcho(body)
+	if err != nil {
+		return fmt.Sprintf("cannot read service: %v", err)
+	}
+	if e.Instance.Service != want {
+		return fmt.Sprintf("answered by service %q, want %q", e.Instance.Service, want)
+	}
+	return ""
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// runHTTP runs every target in the probe matrix and fails only if at least
+// one of them did not meet its expectations.
+func runHTTP() error {
+	targets, err := loadTargets()
+	if err != nil {
+		return err
+	}
+	return runProbes(targets)
+}
+
+// runProbes probes this shard's part of targets once each.
+func runProbes(targets []target) error {
+	if targets = task.targets(targets); len(targets) == 0 {
+		slog.Info("No targets for this shard")
+		return nil
+	}
+
+	policy, err := loadRetryPolicy()
+	if err != nil {
+		return err
+	}
+
+	tr, err := newTransport()
+	if err != nil {
+		return err
+	}
+	clients := newHostClients(tr)
+	failed := 0
+	for _, t := range targets {
+		if r := probe(context.Background(), clients.client(t.Host), t, policy); !r.OK {
+			failed++
+		}
+	}
+
+	slog.Info("Probe summary", "total", len(targets), "passed", len(targets)-failed, "failed", failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d probes failed", failed, len(targets))
+	}
+	return nil
+}
+
+// probe runs t under policy, retrying failed attempts with backoff, and
+// reports the final result.
+func probe(ctx context.Context, client *http.Client, t target, policy retryPolicy) result {
+	ctx, span := startProbe(ctx, "probe "+t.Name,
+		attribute.String("probe.name", t.Name),
+		attribute.String("url.full", t.URL))
+	defer span.End()
+	log := spanLogger(ctx)
+
+	if policy.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.Deadline)
+		defer cancel()
+	}
+
+	var r result
+	var classes []string
+	for n := 1; ; n++ {
+		r = attempt(ctx, client, t)
+		if r.OK || n >= policy.MaxAttempts {
+			r.Attempts = n
+			break
+		}
+		classes = append(classes, r.ErrorClass)
+		wait := policy.backoff(n)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			r.Attempts = n
+			break
+		}
+		log.Warn("Probe attempt failed; retrying",
+			"name", t.Name, "attempt", n, "errorClass", r.ErrorClass,
+			"error", r.Error, "failures", r.Failures, "backoffSeconds", wait.Seconds())
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+		}
+	}
+	if !r.OK {
+		classes = append(classes, r.ErrorClass)
+		span.SetStatus(codes.Error, r.ErrorClass)
+	}
+	r.AttemptClasses = classes
+	report(ctx, r)
+	return r
+}
+
+// attempt sends one request for t and checks it against t's expectations.
+func attempt(ctx context.Context, client *http.Client, t target) result {
+	r := result{Name: t.Name, URL: t.URL, Method: t.Method}
+
+	ctx, cancel := context.WithTimeout(withTargetProxy(ctx, t), t.Timeout)
+	defer cancel()
+
+	var body io.Reader
+	if t.Body != "" {
+		body = strings.NewReader(t.Body)
+	}
+	ctx, rec := withTiming(ctx)
+	req, err := http.NewRequestWithContext(ctx, t.Method, t.URL, body)
+	if err != nil {
+		r.Error, r.ErrorClass = err.Error(), classOther
+		return r
+	}
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+	if t.Host != "" {
+		req.Host = t.Host
+	}
+	r.Proxy = newProxyHop(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		r.Timing = rec.finish()
+		r.LatencySeconds = r.Timing.TotalSeconds
+		r.Error = err.Error()
+		r.TLS = failedTLSState(err)
+		r.OK = t.ExpectUnreachable
+		if !r.OK {
+			r.ErrorClass = rec.classifyError(err)
+		}
+		return r
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	r.Timing = rec.finish()
+	r.LatencySeconds = r.Timing.TotalSeconds
+	r.Status = resp.StatusCode
+	r.TLS = newTLSState(resp.TLS)
+	r.Body = truncate(string(respBody), maxReportedBody)
+	if err != nil {
+		r.Error, r.ErrorClass = err.Error(), classifyError(err)
+		return r
+	}
+
+	if e, err := parseEcho(respBody); err == nil {
+		r.SourceIP = e.Source.Client.IP
+		r.Service = e.Instance.Service
+	}
+	r.Failures, r.ErrorClass = checkResponse(t, resp.StatusCode, respBody)
+	r.OK = len(r.Failures) == 0
+	return r
+}
+
+// checkResponse returns one message per unmet expectation, and the class
+// of the first one.
+func checkResponse(t target, status int, body []byte) (failures []string, class string) {
+	if t.ExpectUnreachable {
+		return []string{fmt.Sprintf("expected no response, got status %d", status)}, classUnexpected
+	}
+	if status != t.ExpectStatus {
+		failures = append(failures, fmt.Sprintf("status %d, want %d", status, t.ExpectStatus))
+		class = classHTTPStatus
+	}
+	for _, want := range t.ExpectBody {
+		if !strings.Contains(string(body), want) {
+			failures = append(failures, fmt.Sprintf("body does not contain %q", want))
+			if class == "" {
+				class = classBodyMismatch
+			}
+		}
+	}
+	if t.sourcePrefix.IsValid() {
+		if msg := checkSource(t.sourcePrefix, body); msg != "" {
+			failures = append(failures, msg)
+			if class == "" {
+				class = classSourceMismatch
+			}
+		}
+	}
+	if t.ExpectService != "" {
+		if msg := checkService(t.ExpectService, body); msg != "" {
+			failures = append(failures, msg)
+			if class == "" {
+				class = classWrongService
+			}
+		}
+	}
+	return failures, class
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "...(truncated)"
+}
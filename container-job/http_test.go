@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"testing"
+	"time"
+)
+
+// blackholeDial behaves like net.Dialer towards a host that drops the SYN:
+// it reports the connect starting, then blocks until the context ends.
+func blackholeDial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if trace := httptrace.ContextClientTrace(ctx); trace != nil && trace.ConnectStart != nil {
+		trace.ConnectStart(network, addr)
+	}
+	<-ctx.Done()
+	err := ctx.Err()
+	if trace := httptrace.ContextClientTrace(ctx); trace != nil && trace.ConnectDone != nil {
+		trace.ConnectDone(network, addr, err)
+	}
+	return nil, err
+}
+
+func TestAttemptClassifiesTimeouts(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	blackholed := &http.Transport{DialContext: blackholeDial}
+	tests := []struct {
+		name      string
+		transport *http.Transport
+		url       string
+		want      string
+	}{
+		{"unanswered SYN", blackholed, "http://10.255.255.1/", classConnectTimeout},
+		{"slow response", http.DefaultTransport.(*http.Transport).Clone(), slow.URL, classTimeout},
+	}
+	for _, tt := range tests {
+		client := &http.Client{Transport: tt.transport}
+		tg := target{Name: tt.name, URL: tt.url, Method: http.MethodGet, Timeout: 100 * time.Millisecond, ExpectStatus: http.StatusOK}
+		r := attempt(context.Background(), client, tg)
+		if r.OK || r.ErrorClass != tt.want {
+			t.Errorf("%s: ok %v class %q (%s), want class %q", tt.name, r.OK, r.ErrorClass, r.Error, tt.want)
+		}
+	}
+}
+
+func TestHostClientsSetServerName(t *testing.T) {
+	var sni string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sni = r.TLS.ServerName
+	}))
+	defer srv.Close()
+
+	base := srv.Client().Transport.(*http.Transport).Clone()
+	clients := newHostClients(base)
+	// The URL is an IP, which sends no SNI of its own; the httptest
+	// certificate covers example.com, so the override also verifies.
+	tg := target{Name: "routed", URL: srv.URL, Host: "example.com:443", Method: http.MethodGet, Timeout: 5 * time.Second, ExpectStatus: http.StatusOK}
+	if r := attempt(context.Background(), clients.client(tg.Host), tg); !r.OK {
+		t.Fatalf("attempt: %s (%s)", r.ErrorClass, r.Error)
+	}
+	if sni != "example.com" {
+		t.Errorf("server saw SNI %q, want example.com", sni)
+	}
+	if base.TLSClientConfig.ServerName != "" {
+		t.Errorf("base transport ServerName changed to %q", base.TLSClientConfig.ServerName)
+	}
+}
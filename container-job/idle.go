@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcomes of reusing a connection after an idle period.
+const (
+	idleKept       = "kept"       // the second request succeeded
+	idleClosed     = "closed"     // a FIN arrived: something closed it cleanly
+	idleReset      = "reset"      // an RST arrived: state for the flow was gone
+	idleBlackholed = "blackholed" // no answer at all: dropped silently
+	idleError      = "error"
+)
+
+// defaultIdlePeriods fit in Cloud Run's default 10-minute task timeout.
+// Cloud NAT keeps established TCP flows for 20 minutes by default, so
+// finding that limit needs longer periods and a longer --task-timeout.
+var defaultIdlePeriods = []time.Duration{
+	30 * time.Second, time.Minute, 2 * time.Minute, 5 * time.Minute, 8 * time.Minute,
+}
+
+// defaultTaskTimeout is Cloud Run's --task-timeout when none is given.
+const defaultTaskTimeout = 10 * time.Minute
+
+// idleStep is the outcome for one idle period, each on its own connection.
+type idleStep struct {
+	IdleSeconds float64 `json:"idle_seconds"`
+	Outcome     string  `json:"outcome"`
+	Error       string  `json:"error,omitempty"`
+	LocalAddr   string  `json:"local_addr,omitempty"`
+}
+
+// idleReport summarises the steps: the longest idle period a connection
+// survived below the first one it did not.
+type idleReport struct {
+	URL                 string     `json:"url"`
+	MaxKeptSeconds      float64    `json:"max_kept_seconds"`
+	FirstDroppedSeconds float64    `json:"first_dropped_seconds,omitempty"`
+	FirstDroppedOutcome string     `json:"first_dropped_outcome,omitempty"`
+	Steps               []idleStep `json:"steps"`
+}
+
+// runIdle finds the effective idle timeout on the path to TARGET_URL. For
+// each of IDLE_PERIODS, in parallel, it opens a keep-alive connection,
+// sends a request, stays silent for the period and then sends a second
+// request on the same connection. Cloud NAT, the ILB's Envoy proxies and
+// Cloud Run each time out idle flows differently; the result says which
+// period first failed and how (closed, reset or blackholed). TCP
+// keep-alives are off so that they cannot hold the flow open. The job
+// fails if a probe could not run, or if a period up to
+// IDLE_EXPECT_AT_LEAST was not kept. It refuses to start when the longest
+// period could outlast CLOUD_RUN_TASK_TIMEOUT (10m unless set), as the task
+// would be killed before reporting anything.
+func runIdle() error {
+	target := os.Getenv("TARGET_URL")
+	if target == "" {
+		return errors.New("TARGET_URL environment variable is required")
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("TARGET_URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("TARGET_URL: scheme must be http or https, got %q", u.Scheme)
+	}
+	periods, err := envDurations("IDLE_PERIODS", defaultIdlePeriods)
+	if err != nil {
+		return err
+	}
+	expect, err := envDuration("IDLE_EXPECT_AT_LEAST", 0)
+	if err != nil {
+		return err
+	}
+	timeout, err := envDuration("TIMEOUT", 10*time.Second)
+	if err != nil {
+		return err
+	}
+	taskTimeout, err := envDuration("CLOUD_RUN_TASK_TIMEOUT", defaultTaskTimeout)
+	if err != nil {
+		return err
+	}
+	// The dial, the TLS handshake and both requests may each take TIMEOUT.
+	if need := slices.Max(periods) + 4*timeout; need > taskTimeout {
+		return fmt.Errorf("IDLE_PERIODS up to %s with TIMEOUT %s can take %s, longer than the %s task timeout; "+
+			"raise --task-timeout and set CLOUD_RUN_TASK_TIMEOUT to match", slices.Max(periods), timeout, need, taskTimeout)
+	}
+	var tlsCfg *tls.Config
+	if u.Scheme == "https" {
+		if tlsCfg, err = loadTLSConfig(); err != nil {
+			return err
+		}
+		if tlsCfg.ServerName == "" {
+			tlsCfg.ServerName = u.Hostname()
+		}
+	}
+
+	slog.Info("Idle probe started", "url", target, "periods", len(periods), "longest", slices.Max(periods).String())
+	start := time.Now()
+	steps := make([]idleStep, len(periods))
+	var wg sync.WaitGroup
+	for i, d := range periods {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			steps[i] = idleProbe(u, tlsCfg, d, timeout)
+			slog.Info("Idle period done", "step", steps[i])
+		}()
+	}
+	wg.Wait()
+
+	rep := idleReport{URL: target, Steps: steps}
+	slices.SortFunc(rep.Steps, func(a, b idleStep) int { return cmp.Compare(a.IdleSeconds, b.IdleSeconds) })
+	for _, st := range rep.Steps {
+		if st.Outcome != idleKept {
+			rep.FirstDroppedSeconds, rep.FirstDroppedOutcome = st.IdleSeconds, st.Outcome
+			break
+		}
+		rep.MaxKeptSeconds = st.IdleSeconds
+	}
+	slog.Info("Idle result", "result", rep)
+
+	o := outcome{Name: "idle " + target, OK: true, Seconds: time.Since(start).Seconds(), Result: rep}
+	if i := slices.IndexFunc(rep.Steps, func(st idleStep) bool { return st.Outcome == idleError }); i >= 0 {
+		err = fmt.Errorf("idle period %gs: %s", rep.Steps[i].IdleSeconds, rep.Steps[i].Error)
+	} else if rep.FirstDroppedOutcome != "" && rep.FirstDroppedSeconds <= expect.Seconds() {
+		err = fmt.Errorf("connection %s after %gs idle, expected to survive %s",
+			rep.FirstDroppedOutcome, rep.FirstDroppedSeconds, expect)
+	}
+	if err != nil {
+		o.OK, o.Class, o.Message = false, rep.FirstDroppedOutcome, err.Error()
+	}
+	record(o)
+	return err
+}
+
+// idleProbe sends a request, idles for d, then checks whether the same
+// connection still works. It speaks HTTP/1.1 directly so nothing can
+// quietly redial: net/http would retry an idempotent request on a fresh
+// connection and hide the reset being measured.
+func idleProbe(u *url.URL, tlsCfg *tls.Config, d, timeout time.Duration) idleStep {
+	st := idleStep{IdleSeconds: d.Seconds()}
+	fail := func(outcome string, err error) idleStep {
+		st.Outcome, st.Error = outcome, err.Error()
+		return st
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), map[string]string{"http": "80", "https": "443"}[u.Scheme])
+	}
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: -1}
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return fail(idleError, err)
+	}
+	defer conn.Close()
+	st.LocalAddr = conn.LocalAddr().String()
+	if tlsCfg != nil {
+		tc := tls.Client(conn, tlsCfg)
+		tc.SetDeadline(time.Now().Add(timeout))
+		if err := tc.Handshake(); err != nil {
+			return fail(idleError, err)
+		}
+		conn = tc
+	}
+	br := bufio.NewReader(conn)
+
+	if err := idleRequest(conn, br, u, timeout); err != nil {
+		return fail(idleError, fmt.Errorf("first request: %v", err))
+	}
+
+	time.Sleep(d)
+
+	// A FIN or RST received while idle is waiting in the socket; a short
+	// read surfaces it before the second request is sent.
+	conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := br.Peek(1); err == nil {
+		return fail(idleError, errors.New("unexpected data while idle"))
+	} else if outcome := idleOutcome(err); outcome == idleClosed || outcome == idleReset {
+		return fail(outcome, err)
+	}
+
+	if err := idleRequest(conn, br, u, timeout); err != nil {
+		if outcome := idleOutcome(err); outcome != "" {
+			return fail(outcome, err)
+		}
+		return fail(idleError, err)
+	}
+	st.Outcome = idleKept
+	return st
+}
+
+// idleOutcome maps a read or write error on a reused connection to an
+// outcome, or "" for any other error.
+func idleOutcome(err error) string {
+	var ne net.Error
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return idleClosed
+	case classifyError(err) == classReset:
+		return idleReset
+	case errors.As(err, &ne) && ne.Timeout():
+		return idleBlackholed
+	}
+	return ""
+}
+
+// idleRequest sends one keep-alive GET and reads the whole response.
+func idleRequest(conn net.Conn, br *bufio.Reader, u *url.URL, timeout time.Duration) error {
+	conn.SetDeadline(time.Now().Add(timeout))
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "container-job/idle")
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.Close {
+		return fmt.Errorf("status %d with Connection: close; the server does not keep connections alive", resp.StatusCode)
+	}
+	return nil
+}
+
+// envDurations reads a comma-separated list of durations.
+func envDurations(key string, def []time.Duration) ([]time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	var ds []time.Duration
+	for _, f := range strings.Split(v, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(f))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("%s: invalid duration %q", key, f)
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// Latencies are recorded in microseconds, from 1µs to 5 minutes, with three
+// significant digits.
+const (
+	histMin     = 1
+	histMax     = int64(5 * time.Minute / time.Microsecond)
+	histSigFigs = 3
+)
+
+// loadProfile is the shape of a load run.
+type loadProfile struct {
+	Concurrency int
+	// QPS is the open-loop arrival rate; 0 means closed loop, each worker
+	// sending its next request as soon as the previous one finishes.
+	QPS      float64
+	Duration time.Duration
+}
+
+func loadLoadProfile() (loadProfile, error) {
+	var p loadProfile
+	var err error
+	if p.Concurrency, err = envInt("LOAD_CONCURRENCY", 10); err != nil {
+		return p, err
+	}
+	if v := os.Getenv("LOAD_QPS"); v != "" {
+		if p.QPS, err = strconv.ParseFloat(v, 64); err != nil {
+			return p, fmt.Errorf("LOAD_QPS: %v", err)
+		}
+	}
+	if p.Duration, err = envDuration("LOAD_DURATION", 30*time.Second); err != nil {
+		return p, err
+	}
+	if p.Concurrency < task.Count {
+		return p, fmt.Errorf("LOAD_CONCURRENCY must be at least the task count (%d)", task.Count)
+	}
+	// The profile describes the whole execution; each task runs its share.
+	p.Concurrency = task.split(p.Concurrency)
+	p.QPS /= float64(task.Count)
+	return p, nil
+}
+
+// latencySummary reports HDR histogram percentiles in milliseconds.
+type latencySummary struct {
+	MinMs    float64 `json:"min_ms"`
+	MeanMs   float64 `json:"mean_ms"`
+	P50Ms    float64 `json:"p50_ms"`
+	P90Ms    float64 `json:"p90_ms"`
+	P95Ms    float64 `json:"p95_ms"`
+	P99Ms    float64 `json:"p99_ms"`
+	P999Ms   float64 `json:"p99_9_ms"`
+	MaxMs    float64 `json:"max_ms"`
+	StdDevMs float64 `json:"stddev_ms"`
+}
+
+func summarise(h *hdrhistogram.Histogram) latencySummary {
+	ms := func(us int64) float64 { return float64(us) / 1000 }
+	return latencySummary{
+		MinMs:    ms(h.Min()),
+		MeanMs:   h.Mean() / 1000,
+		P50Ms:    ms(h.ValueAtQuantile(50)),
+		P90Ms:    ms(h.ValueAtQuantile(90)),
+		P95Ms:    ms(h.ValueAtQuantile(95)),
+		P99Ms:    ms(h.ValueAtQuantile(99)),
+		P999Ms:   ms(h.ValueAtQuantile(99.9)),
+		MaxMs:    ms(h.Max()),
+		StdDevMs: h.StdDev() / 1000,
+	}
+}
+
+// loadReport is the outcome of a load run.
+type loadReport struct {
+	Targets         []string         `json:"targets"`
+	Concurrency     int              `json:"concurrency"`
+	TargetQPS       float64          `json:"target_qps,omitempty"`
+	DurationSeconds float64          `json:"duration_seconds"`
+	Requests        int64            `json:"requests"`
+	Errors          int64            `json:"errors"`
+	ErrorRate       float64          `json:"error_rate"`
+	ErrorsByClass   map[string]int64 `json:"errors_by_class,omitempty"`
+	// Dropped counts open-loop arrivals that never started because every
+	// worker was busy until the run ended; a high value means the target
+	// QPS exceeded what the path could sustain at this concurrency.
+	Dropped        int64          `json:"dropped,omitempty"`
+	ThroughputRPS  float64        `json:"throughput_rps"`
+	ThroughputMbps float64        `json:"throughput_mbps"`
+	Latency        latencySummary `json:"latency"`
+	// Histogram is the base64 HdrHistogram V2 encoding of the latencies,
+	// set when the run is sharded so an aggregator can merge the tasks'
+	// histograms rather than average their percentiles.
+	Histogram string `json:"histogram,omitempty"`
+}
+
+// loadWorker accumulates its own histogram and counters so workers never
+// contend; they are merged when the run ends.
+type loadWorker struct {
+	hist          *hdrhistogram.Histogram
+	requests      int64
+	bytes         int64
+	errorsByClass map[string]int64
+}
+
+// runLoad drives the targets round-robin for LOAD_DURATION and reports
+// latency percentiles, error rates by class and throughput. Latency is
+// measured from each request's scheduled start, so queueing behind a slow
+// path counts against it (no coordinated omission). If LOAD_MAX_ERROR_RATE
+// is set, the run fails when the error rate exceeds it.
+func runLoad() error {
+	targets, err := loadTargets()
+	if err != nil {
+		return err
+	}
+	profile, err := loadLoadProfile()
+	if err != nil {
+		return err
+	}
+	maxErrorRate := math.Inf(1)
+	if v := os.Getenv("LOAD_MAX_ERROR_RATE"); v != "" {
+		if maxErrorRate, err = strconv.ParseFloat(v, 64); err != nil {
+			return fmt.Errorf("LOAD_MAX_ERROR_RATE: %v", err)
+		}
+	}
+
+	tr, err := newTransport()
+	if err != nil {
+		return err
+	}
+
+	rep := runLoadProfile(tr, targets, profile)
+	slog.Info("Load result", "result", rep)
+	o := outcome{Name: "load", OK: true, Seconds: rep.DurationSeconds, Result: rep}
+	if rep.ErrorRate > maxErrorRate {
+		err = fmt.Errorf("error rate %.4f exceeds LOAD_MAX_ERROR_RATE %.4f", rep.ErrorRate, maxErrorRate)
+		o.OK, o.Class, o.Message = false, "error_rate", err.Error()
+	}
+	record(o)
+	return err
+}
+
+func runLoadProfile(tr *http.Transport, targets []target, p loadProfile) loadReport {
+	// Load requests skip the tracing transport: a span per request would
+	// swamp the exporter and skew the numbers being measured.
+	tr.MaxIdleConnsPerHost = p.Concurrency
+	client := &http.Client{Transport: tr}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.Duration)
+	defer cancel()
+
+	// Each value is the scheduled start of one request, or zero in closed
+	// loop, where a worker's own start is the schedule. The channel is
+	// unbuffered so an arrival is only handed out to a free worker.
+	arrivals := make(chan time.Time)
+	var dropped atomic.Int64
+	go schedule(ctx, p, arrivals, &dropped)
+
+	var next atomic.Uint64
+	workers := make([]*loadWorker, p.Concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	slog.Info("Load started", "concurrency", p.Concurrency, "qps", p.QPS, "duration", p.Duration.String(), "targets", len(targets))
+	for i := range workers {
+		w := &loadWorker{
+			hist:          hdrhistogram.New(histMin, histMax, histSigFigs),
+			errorsByClass: map[string]int64{},
+		}
+		workers[i] = w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for scheduled := range arrivals {
+				if ctx.Err() != nil {
+					// The run is over; arrivals still being handed out
+					// never started.
+					if !scheduled.IsZero() {
+						dropped.Add(1)
+					}
+					continue
+				}
+				if scheduled.IsZero() {
+					scheduled = time.Now()
+				}
+				t := targets[next.Add(1)%uint64(len(targets))]
+				n, class := loadRequest(client, t)
+				w.hist.RecordValue(max(histMin, min(histMax, time.Since(scheduled).Microseconds())))
+				w.requests++
+				w.bytes += n
+				if class != "" {
+					w.errorsByClass[class]++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	rep := loadReport{
+		Concurrency:     p.Concurrency,
+		TargetQPS:       p.QPS,
+		DurationSeconds: elapsed.Seconds(),
+		ErrorsByClass:   map[string]int64{},
+		Dropped:         dropped.Load(),
+	}
+	for _, t := range targets {
+		rep.Targets = append(rep.Targets, t.Name)
+	}
+	hist := hdrhistogram.New(histMin, histMax, histSigFigs)
+	var bytes int64
+	for _, w := range workers {
+		hist.Merge(w.hist)
+		rep.Requests += w.requests
+		bytes += w.bytes
+		for class, n := range w.errorsByClass {
+			rep.ErrorsByClass[class] += n
+			rep.Errors += n
+		}
+	}
+	if rep.Requests > 0 {
+		rep.ErrorRate = float64(rep.Errors) / float64(rep.Requests)
+	}
+	rep.ThroughputRPS = float64(rep.Requests) / elapsed.Seconds()
+	rep.ThroughputMbps = float64(bytes) * 8 / 1e6 / elapsed.Seconds()
+	rep.Latency = summarise(hist)
+	if task.Count > 1 {
+		if b, err := hist.Encode(hdrhistogram.V2CompressedEncodingCookieBase); err == nil {
+			rep.Histogram = string(b)
+		}
+	}
+	return rep
+}
+
+// schedule feeds arrivals until ctx ends. Closed loop hands out a zero
+// time whenever a worker is free, so the worker stamps its own start;
+// open loop emits at a fixed rate and counts arrivals still unserved at
+// the end as dropped.
+func schedule(ctx context.Context, p loadProfile, arrivals chan<- time.Time, dropped *atomic.Int64) {
+	defer close(arrivals)
+	if p.QPS <= 0 {
+		for {
+			select {
+			case arrivals <- time.Time{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+
+	interval := time.Duration(float64(time.Second) / p.QPS)
+	var backlog []time.Time
+	next := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		var out chan<- time.Time
+		var head time.Time
+		if len(backlog) > 0 {
+			out, head = arrivals, backlog[0]
+		}
+		select {
+		case <-ctx.Done():
+			dropped.Add(int64(len(backlog)))
+			return
+		case out <- head:
+			backlog = backlog[1:]
+		case <-timer.C:
+			for !next.After(time.Now()) {
+				backlog = append(backlog, next)
+				next = next.Add(interval)
+			}
+			timer.Reset(time.Until(next))
+		}
+	}
+}
+
+// loadRequest sends one request for t and returns the response bytes read
+// and the failure class, "" on success.
+func loadRequest(client *http.Client, t target) (int64, string) {
+	ctx, cancel := context.WithTimeout(withTargetProxy(context.Background(), t), t.Timeout)
+	defer cancel()
+	ctx, rec := withTiming(ctx)
+
+	var body io.Reader
+	if t.Body != "" {
+		body = strings.NewReader(t.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, t.Method, t.URL, body)
+	if err != nil {
+		return 0, classOther
+	}
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+	if t.Host != "" {
+		req.Host = t.Host
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if t.ExpectUnreachable {
+			return 0, ""
+		}
+		return 0, rec.classifyError(err)
+	}
+	defer resp.Body.Close()
+
+	if !t.needsBody() {
+		n, err := io.Copy(io.Discard, resp.Body)
+		if err != nil {
+			return n, classifyError(err)
+		}
+		_, class := checkResponse(t, resp.StatusCode, nil)
+		return n, class
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return int64(len(b)), classifyError(err)
+	}
+	_, class := checkResponse(t, resp.StatusCode, b)
+	return int64(len(b)), class
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunLoadProfileClosedLoop(t *testing.T) {
+	const service = 100 * time.Millisecond
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(service)
+	}))
+	defer srv.Close()
+
+	targets := []target{{Name: "srv", URL: srv.URL, Method: http.MethodGet, Timeout: 5 * time.Second, ExpectStatus: http.StatusOK}}
+	p := loadProfile{Concurrency: 4, Duration: time.Second}
+	rep := runLoadProfile(http.DefaultTransport.(*http.Transport).Clone(), targets, p)
+
+	if rep.Errors != 0 {
+		t.Fatalf("errors: %v", rep.ErrorsByClass)
+	}
+	// Each request's latency is its own service time; queueing for a free
+	// worker would add the previous request's.
+	if rep.Latency.MinMs < 100 || rep.Latency.P50Ms > 150 {
+		t.Errorf("latency min %.1fms p50 %.1fms, want about %v", rep.Latency.MinMs, rep.Latency.P50Ms, service)
+	}
+	// At most the requests in flight at the deadline finish after it.
+	if limit := (p.Duration + service*3/2).Seconds(); rep.DurationSeconds > limit {
+		t.Errorf("run took %.3fs, want under %.3fs", rep.DurationSeconds, limit)
+	}
+	if rep.Requests < 30 || rep.Requests > 44 {
+		t.Errorf("requests = %d, want about 40", rep.Requests)
+	}
+}
+
+func TestScheduleClosedLoop(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	arrivals := make(chan time.Time)
+	var dropped atomic.Int64
+	go schedule(ctx, loadProfile{Concurrency: 1}, arrivals, &dropped)
+
+	n := 0
+	for a := range arrivals {
+		if !a.IsZero() {
+			t.Fatalf("closed-loop arrival stamped %v, want zero", a)
+		}
+		n++
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n == 0 || dropped.Load() != 0 {
+		t.Errorf("got %d arrivals, %d dropped", n, dropped.Load())
+	}
+}
+
+func TestScheduleOpenLoop(t *testing.T) {
+	const qps = 100
+	interval := time.Second / qps
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	arrivals := make(chan time.Time)
+	var dropped atomic.Int64
+	go schedule(ctx, loadProfile{Concurrency: 1, QPS: qps}, arrivals, &dropped)
+
+	// A consumer at half the rate: arrivals keep their scheduled times and
+	// the backlog left at the end is counted as dropped.
+	var got []time.Time
+	for a := range arrivals {
+		got = append(got, a)
+		time.Sleep(2 * interval)
+	}
+	for i := 1; i < len(got); i++ {
+		if d := got[i].Sub(got[i-1]); d != interval {
+			t.Fatalf("arrival %d is %v after the previous, want %v", i, d, interval)
+		}
+	}
+	if total := int64(len(got)) + dropped.Load(); total < 18 || total > 22 {
+		t.Errorf("%d served + %d dropped, want about 20 arrivals", len(got), dropped.Load())
+	}
+	if dropped.Load() == 0 {
+		t.Error("no arrivals dropped, want the unserved backlog counted")
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Trace keys Cloud Logging reads from each JSON line, so the job's entries
+// group with the server's under the same trace.
+const (
+	traceKey        = "logging.googleapis.com/trace"
+	spanIDKey       = "logging.googleapis.com/spanId"
+	traceSampledKey = "logging.googleapis.com/trace_sampled"
+)
+
+// traceProject is the project in the trace names spanLogger writes. It is
+// set by setupLogging.
+var traceProject string
+
+// setupLogging makes the default logger write Cloud Logging JSON to stdout,
+// with severity and message in place of slog's level and msg.
+func setupLogging() {
+	traceProject = projectID()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) > 0 {
+				return a
+			}
+			switch a.Key {
+			case slog.LevelKey:
+				return slog.String("severity", severity(a.Value.Any().(slog.Level)))
+			case slog.MessageKey:
+				a.Key = "message"
+			}
+			return a
+		},
+	})))
+}
+
+func severity(l slog.Level) string {
+	switch {
+	case l >= slog.LevelError:
+		return "ERROR"
+	case l >= slog.LevelWarn:
+		return "WARNING"
+	case l >= slog.LevelInfo:
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
+
+// projectID returns GOOGLE_CLOUD_PROJECT or, on Cloud Run, the project from
+// the metadata server; "" when neither answers.
+func projectID() string {
+	if p := os.Getenv("GOOGLE_CLOUD_PROJECT"); p != "" {
+		return p
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet,
+		"http://metadata.google.internal/computeMetadata/v1/project/project-id", nil)
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+	b, _ := io.ReadAll(resp.Body)
+	return strings.TrimSpace(string(b))
+}
+
+// spanLogger returns a logger carrying ctx's span in Cloud Logging form, so
+// the job's entries join the server's on the same trace.
+func spanLogger(ctx context.Context) *slog.Logger {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return slog.Default()
+	}
+	traceID := sc.TraceID().String()
+	if traceProject != "" {
+		traceID = "projects/" + traceProject + "/traces/" + traceID
+	}
+	return slog.With(
+		slog.String(traceKey, traceID),
+		slog.String(spanIDKey, sc.SpanID().String()),
+		slog.Bool(traceSampledKey, sc.IsSampled()),
+	)
+}
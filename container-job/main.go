@@ -1,29 +1,108 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"io"
-	"net/http"
+	"log/slog"
 	"os"
+	"strconv"
 	"time"
 )
 
 func main() {
-	targetURL := os.Getenv("TARGET_URL")
-	if targetURL == "" {
-		fmt.Fprintln(os.Stderr, "TARGET_URL environment variable is required")
+	setupLogging()
+	var err error
+	if task, err = loadShard(); err != nil {
+		slog.Error("Job failed", "error", err.Error())
 		os.Exit(1)
 	}
+	output, err := loadOutputConfig()
+	if err != nil {
+		slog.Error("Job failed", "error", err.Error())
+		os.Exit(1)
+	}
+	// Every entry names its shard so an aggregator can merge the results of
+	// a multi-task execution.
+	slog.SetDefault(slog.With("shard", task))
+
+	shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		slog.Error("Tracing setup failed", "error", err.Error())
+		os.Exit(1)
+	}
+
+	start := time.Now()
+	mode := envOr("MODE", "http")
+	switch mode {
+	case "http":
+		err = runHTTP()
+	case "converge":
+		err = runConverge()
+	case "routing":
+		err = runRouting()
+	case "dns":
+		err = runDNS()
+	case "load":
+		err = runLoad()
+	case "mtu":
+		err = runMTU()
+	case "idle":
+		err = runIdle()
+	case "churn":
+		err = runChurn()
+	case "tcp", "udp":
+		err = runRawEcho(mode)
+	default:
+		err = fmt.Errorf("unknown MODE %q (want http, converge, routing, dns, load, mtu, idle, churn, tcp or udp)", mode)
+	}
 
-	fmt.Printf("Requesting %s ...\n", targetURL)
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Get(targetURL)
+	if oerr := writeOutput(output, mode, time.Since(start), err); oerr != nil {
+		slog.Error("Writing results failed", "error", oerr.Error())
+		if err == nil {
+			err = oerr
+		}
+	}
+
+	// Flush spans before exiting; os.Exit skips deferred calls.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if ferr := shutdownTracing(ctx); ferr != nil {
+		slog.Warn("Trace flush failed", "error", ferr.Error())
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		slog.Error("Job failed", "error", err.Error())
 		os.Exit(1)
 	}
-	defer resp.Body.Close()
+}
+
+// envOr returns the value of key, or def when it is unset or empty.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func envInt(key string, def int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", key, err)
+	}
+	return n, nil
+}
 
-	body, _ := io.ReadAll(resp.Body)
-	fmt.Printf("Status: %d\nBody:\n%s\n", resp.StatusCode, string(body))
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", key, err)
+	}
+	return d, nil
 }
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Default sweeps. Upload bodies grow from one packet to many megabytes.
+// Segment sizes straddle the MSS, with Linux's 12 bytes of TCP timestamps,
+// for HA VPN's recommended 1440-byte MTU (1388) and for the VPC's 1460-byte
+// MTU (1408); the kernel never sends more than the MSS in one segment.
+var (
+	defaultUploadSizes  = []int{512, 1024, 1360, 1400, 1420, 1440, 1460, 1500, 4096, 16384, 65536, 1 << 20, 8 << 20}
+	defaultSegmentSizes = []int{1200, 1300, 1340, 1360, 1370, 1380, 1388, 1389, 1395, 1400, 1405, 1408}
+)
+
+// ipTCPHeaderBytes is added to a segment's payload to give the IPv4 packet
+// size, ignoring TCP options (Linux adds 12 bytes of timestamps).
+const ipTCPHeaderBytes = 40
+
+// mtuStep is the outcome of one size in a sweep.
+type mtuStep struct {
+	Bytes int `json:"bytes"`
+	// MSS, Segments and PacketBytes are set for TCP steps: the
+	// connection's maximum segment size, the segments the line needed and
+	// the size of the largest IP packet among them, before TCP options.
+	MSS            int     `json:"mss,omitempty"`
+	Segments       int     `json:"segments,omitempty"`
+	PacketBytes    int     `json:"packet_bytes,omitempty"`
+	OK             bool    `json:"ok"`
+	LatencySeconds float64 `json:"latency_seconds"`
+	ErrorClass     string  `json:"error_class,omitempty"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// mtuSweep reports one sweep: HTTP uploads or TCP line echoes.
+type mtuSweep struct {
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+	// LargestOKBytes is the largest size that succeeded below the first
+	// failure; FirstFailureBytes is 0 when every size succeeded.
+	LargestOKBytes    int       `json:"largest_ok_bytes"`
+	FirstFailureBytes int       `json:"first_failure_bytes,omitempty"`
+	FirstFailureClass string    `json:"first_failure_class,omitempty"`
+	Steps             []mtuStep `json:"steps"`
+}
+
+func (sw *mtuSweep) add(st mtuStep) {
+	sw.Steps = append(sw.Steps, st)
+	switch {
+	case !st.OK && sw.FirstFailureBytes == 0:
+		sw.FirstFailureBytes, sw.FirstFailureClass = st.Bytes, st.ErrorClass
+	case st.OK && sw.FirstFailureBytes == 0:
+		sw.LargestOKBytes = st.Bytes
+	}
+}
+
+// runMTU looks for the size at which large packets stop getting through,
+// which HA VPN plus NAT can make smaller than the VPC MTU without any ICMP
+// to say so. It POSTs bodies of MTU_SIZES bytes to the service's /upload
+// endpoint at MTU_URL and checks the SHA-256 it returns, and sends lines
+// of MTU_SEGMENT_SIZES bytes, each on a fresh connection, to the TCP echo
+// listener at TARGET_ADDR. A size that times out is the
+// usual sign of silent blackholing.
+func runMTU() error {
+	url, addr := os.Getenv("MTU_URL"), os.Getenv("TARGET_ADDR")
+	if url == "" && addr == "" {
+		return errors.New("MTU_URL (the service's /upload endpoint) or TARGET_ADDR (its TCP echo listener) is required")
+	}
+	timeout, err := envDuration("TIMEOUT", 10*time.Second)
+	if err != nil {
+		return err
+	}
+
+	var sweeps []mtuSweep
+	if url != "" {
+		sizes, err := envSizes("MTU_SIZES", defaultUploadSizes)
+		if err != nil {
+			return err
+		}
+		tr, err := newTransport()
+		if err != nil {
+			return err
+		}
+		client := &http.Client{Transport: tr, Timeout: timeout}
+		sw := mtuSweep{Kind: "http", Target: url}
+		for _, n := range sizes {
+			sw.add(uploadStep(client, url, n))
+		}
+		sweeps = append(sweeps, sw)
+	}
+	if addr != "" {
+		sizes, err := envSizes("MTU_SEGMENT_SIZES", defaultSegmentSizes)
+		if err != nil {
+			return err
+		}
+		sw := mtuSweep{Kind: "tcp", Target: addr}
+		for _, n := range sizes {
+			sw.add(segmentStep(addr, n, timeout))
+		}
+		sweeps = append(sweeps, sw)
+	}
+
+	var failed []string
+	for _, sw := range sweeps {
+		level := slog.LevelInfo
+		o := outcome{Name: "mtu " + sw.Kind, OK: true, Result: sw}
+		for _, st := range sw.Steps {
+			o.Seconds += st.LatencySeconds
+		}
+		if sw.FirstFailureBytes > 0 {
+			level = slog.LevelError
+			o.OK, o.Class = false, sw.FirstFailureClass
+			o.Message = fmt.Sprintf("%d bytes failed; largest OK below it %d", sw.FirstFailureBytes, sw.LargestOKBytes)
+			failed = append(failed, fmt.Sprintf("%s from %d bytes", sw.Kind, sw.FirstFailureBytes))
+		}
+		slog.Log(context.Background(), level, "MTU result", "result", sw)
+		record(o)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("large payloads failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// uploadStep POSTs n random bytes and checks the size and digest the
+// service reports back.
+func uploadStep(client *http.Client, url string, n int) mtuStep {
+	st := mtuStep{Bytes: n}
+	body := make([]byte, n)
+	rand.NewChaCha8([32]byte{byte(n), byte(n >> 8), byte(n >> 16)}).Read(body)
+	sum := sha256.Sum256(body)
+
+	start := time.Now()
+	resp, err := client.Post(url, "application/octet-stream", bytes.NewReader(body))
+	if err != nil {
+		st.LatencySeconds = time.Since(start).Seconds()
+		st.Error, st.ErrorClass = err.Error(), classifyError(err)
+		return st
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	st.LatencySeconds = time.Since(start).Seconds()
+	if err != nil {
+		st.Error, st.ErrorClass = err.Error(), classifyError(err)
+		return st
+	}
+	if resp.StatusCode != http.StatusOK {
+		st.Error, st.ErrorClass = fmt.Sprintf("status %d: %s", resp.StatusCode, truncate(string(b), 200)), classHTTPStatus
+		return st
+	}
+	var reply struct {
+		Bytes  int    `json:"bytes"`
+		SHA256 string `json:"sha256"`
+	}
+	if err := json.Unmarshal(b, &reply); err != nil {
+		st.Error, st.ErrorClass = fmt.Sprintf("not an upload reply: %v", err), classUnexpected
+		return st
+	}
+	if reply.Bytes != n || reply.SHA256 != hex.EncodeToString(sum[:]) {
+		st.Error = fmt.Sprintf("server received %d bytes with sha256 %s", reply.Bytes, reply.SHA256)
+		st.ErrorClass = classBodyMismatch
+		return st
+	}
+	st.OK = true
+	return st
+}
+
+// segmentStep sends a single n-byte line (n-1 bytes plus the newline) on
+// a new connection and waits for the echo listener's reply. With
+// TCP_NODELAY a line up to the connection's MSS leaves in one segment; a
+// longer one is split, and its largest packet is the MSS-sized one.
+func segmentStep(addr string, n int, timeout time.Duration) (st mtuStep) {
+	st = mtuStep{Bytes: n}
+	start := time.Now()
+	defer func() { st.LatencySeconds = time.Since(start).Seconds() }()
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		st.Error, st.ErrorClass = err.Error(), classifyError(err)
+		return st
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if st.MSS, err = tcpMSS(conn); err != nil {
+		st.Error, st.ErrorClass = fmt.Sprintf("read MSS: %v", err), classOther
+		return st
+	}
+	st.Segments = (n + st.MSS - 1) / st.MSS
+	st.PacketBytes = min(n, st.MSS) + ipTCPHeaderBytes
+
+	line := append(bytes.Repeat([]byte("x"), n-1), '\n')
+	if _, err := conn.Write(line); err != nil {
+		st.Error, st.ErrorClass = err.Error(), classifyError(err)
+		return st
+	}
+	reply, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		st.Error, st.ErrorClass = err.Error(), classifyError(err)
+		return st
+	}
+	var echo struct {
+		Bytes int `json:"bytes"`
+	}
+	if err := json.Unmarshal(reply, &echo); err != nil {
+		st.Error, st.ErrorClass = fmt.Sprintf("not an echo reply: %v", err), classUnexpected
+		return st
+	}
+	if echo.Bytes != n-1 {
+		st.Error, st.ErrorClass = fmt.Sprintf("listener received %d bytes, sent %d", echo.Bytes, n-1), classBodyMismatch
+		return st
+	}
+	st.OK = true
+	return st
+}
+
+// tcpMSS returns the connection's maximum segment size (TCP_MAXSEG): the
+// most payload the kernel puts in one segment, net of TCP options.
+func tcpMSS(conn net.Conn) (int, error) {
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return 0, errors.New("not a TCP connection")
+	}
+	raw, err := tc.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var mss int
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		mss, sockErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_MAXSEG)
+	}); err != nil {
+		return 0, err
+	}
+	return mss, sockErr
+}
+
+// envSizes reads a comma-separated list of byte counts.
+func envSizes(key string, def []int) ([]int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	var sizes []int
+	for _, f := range strings.Split(v, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%s: invalid size %q", key, f)
+		}
+		sizes = append(sizes, n)
+	}
+	return sizes, nil
+}
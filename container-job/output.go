@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// outcome is one entry in the results file: a probe, a target's convergence
+// or a whole load run. In JUnit terms it is a test case.
+type outcome struct {
+	Name    string
+	OK      bool
+	Class   string
+	Message string
+	Seconds float64
+	// Result is the record also logged to stdout (result, convergence,
+	// loadReport).
+	Result any
+}
+
+// outcomes collects what record is given during the run, for writeOutput.
+var outcomes struct {
+	sync.Mutex
+	list []outcome
+}
+
+func record(o outcome) {
+	outcomes.Lock()
+	defer outcomes.Unlock()
+	outcomes.list = append(outcomes.list, o)
+}
+
+// outputConfig selects the results file. Structured logs always go to
+// stdout; OUTPUT_FORMAT (jsonl or junit) additionally writes the run's
+// outcomes to OUTPUT_PATH, or sends them to OUTPUT_URL with OUTPUT_METHOD
+// (POST; PUT for a signed Cloud Storage URL).
+type outputConfig struct {
+	Format string
+	Path   string
+	URL    string
+	Method string
+}
+
+func loadOutputConfig() (outputConfig, error) {
+	c := outputConfig{
+		Format: envOr("OUTPUT_FORMAT", "jsonl"),
+		Path:   os.Getenv("OUTPUT_PATH"),
+		URL:    os.Getenv("OUTPUT_URL"),
+		Method: envOr("OUTPUT_METHOD", http.MethodPost),
+	}
+	switch c.Format {
+	case "jsonl":
+	case "junit":
+		if c.Path == "" && c.URL == "" {
+			return c, fmt.Errorf("OUTPUT_FORMAT=junit needs OUTPUT_PATH or OUTPUT_URL")
+		}
+	default:
+		return c, fmt.Errorf("unknown OUTPUT_FORMAT %q (want jsonl or junit)", c.Format)
+	}
+	return c, nil
+}
+
+// writeOutput writes the outcomes of a run of mode, which ended with runErr
+// after elapsed. A run that recorded nothing (tcp, udp, churn, or a setup
+// error) becomes a single outcome named after the mode.
+func writeOutput(c outputConfig, mode string, elapsed time.Duration, runErr error) error {
+	if c.Path == "" && c.URL == "" {
+		return nil
+	}
+	outcomes.Lock()
+	list := outcomes.list
+	outcomes.Unlock()
+	if len(list) == 0 {
+		o := outcome{Name: mode, OK: runErr == nil, Seconds: elapsed.Seconds()}
+		if runErr != nil {
+			o.Class, o.Message = classifyError(runErr), runErr.Error()
+		}
+		list = []outcome{o}
+	}
+
+	var buf bytes.Buffer
+	contentType := "application/x-ndjson"
+	if c.Format == "junit" {
+		contentType = "application/xml"
+		if err := writeJUnit(&buf, mode, elapsed, list); err != nil {
+			return err
+		}
+	} else if err := writeJSONL(&buf, mode, list); err != nil {
+		return err
+	}
+
+	if c.Path != "" {
+		if err := os.WriteFile(c.Path, buf.Bytes(), 0o644); err != nil {
+			return err
+		}
+	}
+	if c.URL != "" {
+		return upload(c, contentType, buf.Bytes())
+	}
+	return nil
+}
+
+// writeJSONL writes one line per outcome, tagged with the mode and shard so
+// lines from every task of an execution can be concatenated.
+func writeJSONL(w io.Writer, mode string, list []outcome) error {
+	enc := json.NewEncoder(w)
+	for _, o := range list {
+		line := struct {
+			Mode   string `json:"mode"`
+			Shard  shard  `json:"shard"`
+			Name   string `json:"name"`
+			OK     bool   `json:"ok"`
+			Result any    `json:"result,omitempty"`
+			Error  string `json:"error,omitempty"`
+		}{mode, task, o.Name, o.OK, o.Result, o.Message}
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Time       float64         `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Hostname   string          `xml:"hostname,attr,omitempty"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitCase     `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitCase struct {
+	Classname string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Type    string `xml:"type,attr"`
+	Message string `xml:"message,attr"`
+}
+
+// writeJUnit writes list as one test suite per task, named after the mode
+// and shard so suites from every task of an execution stay distinct.
+func writeJUnit(w io.Writer, mode string, elapsed time.Duration, list []outcome) error {
+	hostname, _ := os.Hostname()
+	suite := junitSuite{
+		Name:      fmt.Sprintf("container-job/%s/%d", mode, task.Index),
+		Tests:     len(list),
+		Time:      elapsed.Seconds(),
+		Timestamp: time.Now().Add(-elapsed).UTC().Format("2006-01-02T15:04:05"),
+		Hostname:  hostname,
+		Properties: []junitProperty{
+			{"mode", mode},
+			{"task_index", fmt.Sprint(task.Index)},
+			{"task_count", fmt.Sprint(task.Count)},
+		},
+	}
+	if e := os.Getenv("CLOUD_RUN_EXECUTION"); e != "" {
+		suite.Properties = append(suite.Properties, junitProperty{"execution", e})
+	}
+	for _, o := range list {
+		tc := junitCase{Classname: mode, Name: o.Name, Time: o.Seconds}
+		if o.Result != nil {
+			b, err := json.Marshal(o.Result)
+			if err != nil {
+				return err
+			}
+			tc.SystemOut = string(b)
+		}
+		if !o.OK {
+			suite.Failures++
+			tc.Failure = &junitFailure{Type: o.Class, Message: o.Message}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitSuites{Suites: []junitSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func upload(c outputConfig, contentType string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, c.Method, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("upload to OUTPUT_URL: status %d: %s", resp.StatusCode, b)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// proxyDirect in a target's proxy field sends it straight to the target,
+// ignoring PROXY_URL and the environment.
+const proxyDirect = "direct"
+
+// envProxy chooses a proxy from PROXY_URL, which applies to both schemes,
+// else HTTP_PROXY and HTTPS_PROXY; NO_PROXY exempts hosts from either.
+var envProxy = sync.OnceValue(func() func(*url.URL) (*url.URL, error) {
+	cfg := httpproxy.FromEnvironment()
+	if p := os.Getenv("PROXY_URL"); p != "" {
+		cfg.HTTPProxy, cfg.HTTPSProxy = p, p
+	}
+	return cfg.ProxyFunc()
+})
+
+// proxyOverride carries a target's own proxy choice in the request
+// context; a nil URL means direct.
+type proxyOverride struct{ url *url.URL }
+
+type proxyKey struct{}
+
+// withTargetProxy returns ctx carrying t's proxy choice, if it has one.
+func withTargetProxy(ctx context.Context, t target) context.Context {
+	if t.Proxy == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, proxyKey{}, proxyOverride{t.proxyURL})
+}
+
+// proxyFor is the Transport's Proxy func: the target's own choice, else
+// the environment's.
+func proxyFor(req *http.Request) (*url.URL, error) {
+	if o, ok := req.Context().Value(proxyKey{}).(proxyOverride); ok {
+		return o.url, nil
+	}
+	return envProxy()(req.URL)
+}
+
+// parseProxy validates a target's proxy field: "direct" or a proxy URL.
+func parseProxy(v string) (*url.URL, error) {
+	if v == proxyDirect {
+		return nil, nil
+	}
+	u, err := url.Parse(v)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an http:// or https:// proxy URL (or %q)", v, proxyDirect)
+	}
+	return u, nil
+}
+
+// proxyConnectError is a CONNECT the proxy refused, e.g. 403 from an
+// allow-list.
+type proxyConnectError struct {
+	Proxy  string
+	Status string
+}
+
+func (e *proxyConnectError) Error() string {
+	return fmt.Sprintf("proxy %s refused CONNECT: %s", e.Proxy, e.Status)
+}
+
+// checkProxyConnect turns a non-200 CONNECT response into a typed error;
+// net/http would otherwise return only the status text.
+func checkProxyConnect(_ context.Context, proxy *url.URL, _ *http.Request, resp *http.Response) error {
+	if resp.StatusCode != http.StatusOK {
+		return &proxyConnectError{Proxy: proxy.Redacted(), Status: resp.Status}
+	}
+	return nil
+}
+
+// proxyHop describes how a request reached its target through a proxy:
+// "connect" tunnels HTTPS through it, "forward" hands it plain HTTP.
+type proxyHop struct {
+	URL  string `json:"url"`
+	Mode string `json:"mode"`
+}
+
+func newProxyHop(req *http.Request) *proxyHop {
+	u, err := proxyFor(req)
+	if err != nil || u == nil {
+		return nil
+	}
+	mode := "forward"
+	if req.URL.Scheme == "https" {
+		mode = "connect"
+	}
+	return &proxyHop{URL: u.Redacted(), Mode: mode}
+}
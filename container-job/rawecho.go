@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"time"
+)
+
+// runRawEcho sends PAYLOAD to the TCP or UDP echo listener at TARGET_ADDR
+// COUNT times and logs each reply, which carries the peer address the
+// server observed after NAT.
+func runRawEcho(network string) error {
+	addr := os.Getenv("TARGET_ADDR")
+	if addr == "" {
+		return errors.New("TARGET_ADDR environment variable is required (host:port)")
+	}
+	payload := envOr("PAYLOAD", "ping")
+	count, err := envInt("COUNT", 1)
+	if err != nil {
+		return err
+	}
+	timeout, err := envDuration("TIMEOUT", 10*time.Second)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Dialling", "network", network, "addr", addr)
+	conn, err := net.DialTimeout(network, addr, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	slog.Info("Connected", "network", network, "addr", addr, "local", conn.LocalAddr().String())
+
+	r := bufio.NewReader(conn)
+	buf := make([]byte, 65507)
+	for i := 1; i <= count; i++ {
+		conn.SetDeadline(time.Now().Add(timeout))
+		var reply []byte
+		if network == "tcp" {
+			if _, err := fmt.Fprintf(conn, "%s\n", payload); err != nil {
+				return fmt.Errorf("send %d: %v", i, err)
+			}
+			line, err := r.ReadBytes('\n')
+			if err != nil {
+				return fmt.Errorf("reply %d: %v", i, err)
+			}
+			reply = line
+		} else {
+			if _, err := conn.Write([]byte(payload)); err != nil {
+				return fmt.Errorf("send %d: %v", i, err)
+			}
+			n, err := conn.Read(buf)
+			if err != nil {
+				return fmt.Errorf("reply %d: %v", i, err)
+			}
+			reply = buf[:n]
+		}
+		slog.Info("Reply", "network", network, "seq", i, "reply", jsonOrString(reply))
+	}
+	return nil
+}
+
+// jsonOrString embeds b as JSON when it is valid (the echo listener's
+// replies are), so log queries can reach into it, and as a string otherwise.
+func jsonOrString(b []byte) any {
+	b = bytes.TrimSpace(b)
+	if json.Valid(b) {
+		return json.RawMessage(b)
+	}
+	return string(b)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// maxReportedBody caps how much of a response body is kept in a result.
+const maxReportedBody = 4096
+
+// result is the outcome of one probe.
+type result struct {
+	Name           string    `json:"name"`
+	URL            string    `json:"url"`
+	Method         string    `json:"method"`
+	OK             bool      `json:"ok"`
+	Status         int       `json:"status,omitempty"`
+	ErrorClass     string    `json:"error_class,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	Failures       []string  `json:"failures,omitempty"`
+	LatencySeconds float64   `json:"latency_seconds"`
+	Timing         *timing   `json:"timing,omitempty"`
+	TLS            *tlsState `json:"tls,omitempty"`
+	// Proxy is the proxy hop, when the request went through one.
+	Proxy *proxyHop `json:"proxy,omitempty"`
+	Body  string    `json:"body,omitempty"`
+	// SourceIP is the client address the target reported in its echo
+	// reply, when it sent one.
+	SourceIP string `json:"source_ip,omitempty"`
+	// Service is the Cloud Run service that answered, from the same reply.
+	Service string `json:"service,omitempty"`
+
+	// Attempts counts every try; AttemptClasses lists the failure class of
+	// each failed one, oldest first.
+	Attempts       int      `json:"attempts"`
+	AttemptClasses []string `json:"attempt_classes,omitempty"`
+}
+
+// report logs r against ctx's span, at ERROR severity when it failed, and
+// records it for the results file.
+func report(ctx context.Context, r result) {
+	level := slog.LevelInfo
+	if !r.OK {
+		level = slog.LevelError
+	}
+	spanLogger(ctx).Log(ctx, level, "Probe result", "result", r)
+
+	msg := r.Error
+	if msg == "" {
+		msg = strings.Join(r.Failures, "; ")
+	}
+	record(outcome{Name: r.Name, OK: r.OK, Class: r.ErrorClass, Message: msg, Seconds: r.LatencySeconds, Result: r})
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// retryPolicy bounds how hard a probe tries before giving up. BGP
+// convergence and NAT programming are eventually consistent, so a failure
+// right after setup-connectivity.sh is often transient.
+type retryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Deadline caps the total time spent on one target, 0 for no cap.
+	Deadline time.Duration
+}
+
+func loadRetryPolicy() (retryPolicy, error) {
+	var p retryPolicy
+	var err error
+	if p.MaxAttempts, err = envInt("RETRY_MAX_ATTEMPTS", 3); err != nil {
+		return p, err
+	}
+	if p.InitialBackoff, err = envDuration("RETRY_INITIAL_BACKOFF", 500*time.Millisecond); err != nil {
+		return p, err
+	}
+	if p.MaxBackoff, err = envDuration("RETRY_MAX_BACKOFF", 5*time.Second); err != nil {
+		return p, err
+	}
+	if p.Deadline, err = envDuration("RETRY_DEADLINE", 0); err != nil {
+		return p, err
+	}
+	if p.MaxAttempts < 1 {
+		p.MaxAttempts = 1
+	}
+	return p, nil
+}
+
+// backoff returns the wait before retry number n (1-based): exponential
+// growth capped at MaxBackoff, with full jitter so parallel tasks spread out.
+func (p retryPolicy) backoff(n int) time.Duration {
+	d := p.InitialBackoff << (n - 1)
+	if d > p.MaxBackoff || d <= 0 {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d + 1)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// route is one row of a URL map: requests for Host and Path must reach the
+// Cloud Run service Service.
+type route struct {
+	Name    string `yaml:"name"`
+	Host    string `yaml:"host"`
+	Path    string `yaml:"path"`
+	Service string `yaml:"service"`
+	// ExpectStatus defaults to 200; set it (and leave Service empty) for
+	// rows that must fall through to a default that is not an echo service.
+	ExpectStatus int `yaml:"expect_status"`
+}
+
+// runRouting sends every row of ROUTES (or ROUTES_FILE) to the single ILB
+// at ROUTING_URL and checks, from the echo reply, which service answered.
+// It validates URL-map host and path rules before services move off their
+// own forwarding rules.
+func runRouting() error {
+	targets, err := loadRoutes()
+	if err != nil {
+		return err
+	}
+	return runProbes(targets)
+}
+
+func loadRoutes() ([]target, error) {
+	base := strings.TrimSuffix(os.Getenv("ROUTING_URL"), "/")
+	if base == "" {
+		return nil, errors.New("ROUTING_URL environment variable is required (e.g. https://10.2.0.10)")
+	}
+	routes, err := loadList[route]("ROUTES", "ROUTES_FILE")
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]target, len(routes))
+	for i, rt := range routes {
+		if rt.Host == "" && rt.Service == "" {
+			return nil, fmt.Errorf("route %d: host or service is required", i)
+		}
+		path := rt.Path
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		name := rt.Name
+		if name == "" {
+			name = rt.Host + path
+		}
+		targets[i] = target{
+			Name:          name,
+			URL:           base + path,
+			Host:          rt.Host,
+			Headers:       map[string]string{"Accept": "application/json"},
+			ExpectStatus:  rt.ExpectStatus,
+			ExpectService: rt.Service,
+		}
+	}
+	return withDefaults(targets)
+}
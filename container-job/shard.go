@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// shard identifies this task among the parallel tasks of one job execution
+// (gcloud run jobs execute --tasks=N). Outside Cloud Run the job is the
+// only shard.
+type shard struct {
+	Index int `json:"index"`
+	Count int `json:"count"`
+}
+
+// task is this process's shard. It is set once at startup by main.
+var task = shard{Index: 0, Count: 1}
+
+// loadShard reads the shard from CLOUD_RUN_TASK_INDEX and
+// CLOUD_RUN_TASK_COUNT, which Cloud Run sets on every job task.
+func loadShard() (shard, error) {
+	s := shard{Index: 0, Count: 1}
+	var err error
+	if v := os.Getenv("CLOUD_RUN_TASK_INDEX"); v != "" {
+		if s.Index, err = strconv.Atoi(v); err != nil {
+			return s, fmt.Errorf("CLOUD_RUN_TASK_INDEX: %v", err)
+		}
+	}
+	if v := os.Getenv("CLOUD_RUN_TASK_COUNT"); v != "" {
+		if s.Count, err = strconv.Atoi(v); err != nil {
+			return s, fmt.Errorf("CLOUD_RUN_TASK_COUNT: %v", err)
+		}
+	}
+	if s.Count < 1 || s.Index < 0 || s.Index >= s.Count {
+		return s, fmt.Errorf("task index %d out of range for task count %d", s.Index, s.Count)
+	}
+	return s, nil
+}
+
+// targets returns this shard's slice of the probe matrix: every Count-th
+// target, starting at Index.
+func (s shard) targets(all []target) []target {
+	var mine []target
+	for i, t := range all {
+		if i%s.Count == s.Index {
+			mine = append(mine, t)
+		}
+	}
+	return mine
+}
+
+// split returns this shard's part of n, giving the remainder to the lowest
+// indexes so the parts add up to n.
+func (s shard) split(n int) int {
+	part := n / s.Count
+	if s.Index < n%s.Count {
+		part++
+	}
+	return part
+}
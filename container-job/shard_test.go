@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestShardSplit(t *testing.T) {
+	tests := []struct {
+		n, count int
+		want     []int // part for each index
+	}{
+		{n: 10, count: 1, want: []int{10}},
+		{n: 10, count: 2, want: []int{5, 5}},
+		{n: 10, count: 3, want: []int{4, 3, 3}},
+		{n: 11, count: 4, want: []int{3, 3, 3, 2}},
+		{n: 3, count: 3, want: []int{1, 1, 1}},
+		{n: 2, count: 3, want: []int{1, 1, 0}},
+		{n: 0, count: 2, want: []int{0, 0}},
+	}
+	for _, tt := range tests {
+		for i, want := range tt.want {
+			if got := (shard{Index: i, Count: tt.count}).split(tt.n); got != want {
+				t.Errorf("shard %d/%d split(%d) = %d, want %d", i, tt.count, tt.n, got, want)
+			}
+		}
+	}
+}
+
+func TestShardTargets(t *testing.T) {
+	var all []target
+	for i := range 7 {
+		all = append(all, target{Name: strconv.Itoa(i)})
+	}
+	for count := 1; count <= 8; count++ {
+		seen := map[string]int{}
+		for i := range count {
+			for _, tg := range (shard{Index: i, Count: count}).targets(all) {
+				seen[tg.Name]++
+			}
+		}
+		for _, tg := range all {
+			if seen[tg.Name] != 1 {
+				t.Errorf("count %d: target %s assigned %d times, want once", count, tg.Name, seen[tg.Name])
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// target is one entry in the probe matrix. TARGETS (inline) or TARGETS_FILE
+// (a mounted file) hold a JSON or YAML list of these; JSON is valid YAML, so
+// one parser handles both.
+type target struct {
+	Name    string            `yaml:"name"`
+	URL     string            `yaml:"url"`
+	Method  string            `yaml:"method"`
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`
+	Timeout time.Duration     `yaml:"timeout"`
+	// Host overrides the Host header, for host rules on a shared ILB; a
+	// Host entry in Headers would be ignored by net/http.
+	Host string `yaml:"host"`
+
+	// ExpectStatus defaults to 200.
+	ExpectStatus int `yaml:"expect_status"`
+	// ExpectBody lists substrings that must all appear in the response body.
+	ExpectBody []string `yaml:"expect_body"`
+	// ExpectUnreachable inverts the probe for negative cases: it passes
+	// only if no HTTP response comes back (e.g. spoke-to-spoke isolation).
+	ExpectUnreachable bool `yaml:"expect_unreachable"`
+	// ExpectSourceCIDR is the range the target must have seen the request
+	// come from, read from source.client.ip in its echo reply. It catches
+	// traffic leaving through an unintended NAT or connector.
+	ExpectSourceCIDR string `yaml:"expect_source_cidr"`
+	// ExpectService is the Cloud Run service (K_SERVICE) that must have
+	// answered, read from instance.service in its echo reply.
+	ExpectService string `yaml:"expect_service"`
+	// Proxy overrides PROXY_URL and HTTP(S)_PROXY for this target: a proxy
+	// URL, or "direct" to bypass them, so one matrix can prove both paths.
+	Proxy string `yaml:"proxy"`
+
+	sourcePrefix netip.Prefix
+	proxyURL     *url.URL
+}
+
+// needsBody reports whether checking t's response requires reading its body.
+func (t target) needsBody() bool {
+	return len(t.ExpectBody) > 0 || t.sourcePrefix.IsValid() || t.ExpectService != ""
+}
+
+// loadTargets reads the probe matrix from TARGETS or TARGETS_FILE, falling
+// back to a single GET of TARGET_URL.
+func loadTargets() ([]target, error) {
+	if os.Getenv("TARGETS") == "" && os.Getenv("TARGETS_FILE") == "" {
+		u := os.Getenv("TARGET_URL")
+		if u == "" {
+			return nil, errors.New("one of TARGETS, TARGETS_FILE or TARGET_URL is required")
+		}
+		return withDefaults([]target{{Name: u, URL: u}})
+	}
+	targets, err := loadList[target]("TARGETS", "TARGETS_FILE")
+	if err != nil {
+		return nil, err
+	}
+	return withDefaults(targets)
+}
+
+// loadList decodes a JSON or YAML list given inline in the inlineEnv
+// variable, or in the file named by fileEnv. Unknown fields and an empty
+// list are errors.
+func loadList[T any](inlineEnv, fileEnv string) ([]T, error) {
+	var data []byte
+	src := inlineEnv
+	switch {
+	case os.Getenv(inlineEnv) != "":
+		data = []byte(os.Getenv(inlineEnv))
+	case os.Getenv(fileEnv) != "":
+		src = fileEnv
+		b, err := os.ReadFile(os.Getenv(fileEnv))
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	default:
+		return nil, fmt.Errorf("one of %s or %s is required", inlineEnv, fileEnv)
+	}
+
+	var list []T
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&list); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", src, err)
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("%s: list is empty", src)
+	}
+	return list, nil
+}
+
+func withDefaults(targets []target) ([]target, error) {
+	timeout, err := envDuration("TIMEOUT", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	for i := range targets {
+		t := &targets[i]
+		if t.URL == "" {
+			return nil, fmt.Errorf("target %d: url is required", i)
+		}
+		if t.Name == "" {
+			t.Name = t.URL
+		}
+		if t.Method == "" {
+			t.Method = http.MethodGet
+		}
+		if t.Timeout == 0 {
+			t.Timeout = timeout
+		}
+		if t.ExpectStatus == 0 {
+			t.ExpectStatus = http.StatusOK
+		}
+		if t.Proxy != "" {
+			u, err := parseProxy(t.Proxy)
+			if err != nil {
+				return nil, fmt.Errorf("target %q: proxy: %v", t.Name, err)
+			}
+			t.proxyURL = u
+		}
+		if t.ExpectSourceCIDR != "" {
+			p, err := netip.ParsePrefix(t.ExpectSourceCIDR)
+			if err != nil {
+				return nil, fmt.Errorf("target %q: expect_source_cidr: %v", t.Name, err)
+			}
+			t.sourcePrefix = p.Masked()
+		}
+	}
+	return targets, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// timing breaks one request down by phase. Phases that did not happen (DNS
+// for an IP literal, connect and TLS on a reused connection) are zero.
+type timing struct {
+	DNSSeconds     float64 `json:"dns_seconds"`
+	ConnectSeconds float64 `json:"connect_seconds"`
+	TLSSeconds     float64 `json:"tls_seconds"`
+	// TTFBSeconds runs from the start of the request to the first response
+	// byte, so it includes the earlier phases.
+	TTFBSeconds  float64 `json:"ttfb_seconds"`
+	TotalSeconds float64 `json:"total_seconds"`
+	Reused       bool    `json:"reused"`
+	WasIdle      bool    `json:"was_idle,omitempty"`
+	IdleSeconds  float64 `json:"idle_seconds,omitempty"`
+	LocalAddr    string  `json:"local_addr,omitempty"`
+	RemoteAddr   string  `json:"remote_addr,omitempty"`
+}
+
+// timingRecorder collects httptrace callbacks. Dialling may race IPv4 and
+// IPv6 on separate goroutines, hence the mutex.
+type timingRecorder struct {
+	mu                     sync.Mutex
+	start                  time.Time
+	dnsStart, connectStart time.Time
+	tlsStart               time.Time
+	connected              bool
+	t                      timing
+}
+
+// withTiming returns a context whose requests are traced into the recorder.
+func withTiming(ctx context.Context) (context.Context, *timingRecorder) {
+	rec := &timingRecorder{start: time.Now()}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+			rec.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+			rec.t.DNSSeconds = time.Since(rec.dnsStart).Seconds()
+		},
+		ConnectStart: func(string, string) {
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+			if rec.connectStart.IsZero() {
+				rec.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+			if err == nil {
+				rec.connected = true
+				rec.t.ConnectSeconds = time.Since(rec.connectStart).Seconds()
+			}
+		},
+		TLSHandshakeStart: func() {
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+			rec.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+			rec.t.TLSSeconds = time.Since(rec.tlsStart).Seconds()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+			rec.connected = true
+			rec.t.Reused = info.Reused
+			rec.t.WasIdle = info.WasIdle
+			rec.t.IdleSeconds = info.IdleTime.Seconds()
+			rec.t.LocalAddr = info.Conn.LocalAddr().String()
+			rec.t.RemoteAddr = info.Conn.RemoteAddr().String()
+		},
+		GotFirstResponseByte: func() {
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+			rec.t.TTFBSeconds = time.Since(rec.start).Seconds()
+		},
+	}), rec
+}
+
+// classifyError is classifyError with what the trace saw. The request
+// deadline is shorter than the dialer's, so an unanswered SYN surfaces as
+// a plain deadline error; if a connect started and no connection came of
+// it, that is a connect timeout.
+func (rec *timingRecorder) classifyError(err error) string {
+	class := classifyError(err)
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if class == classTimeout && !rec.connectStart.IsZero() && !rec.connected {
+		return classConnectTimeout
+	}
+	return class
+}
+
+// finish stamps the total time and returns the collected timing.
+func (rec *timingRecorder) finish() *timing {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	t := rec.t
+	t.TotalSeconds = time.Since(rec.start).Seconds()
+	return &t
+}
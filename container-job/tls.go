@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// loadTLSConfig builds the client TLS settings shared by every HTTP mode:
+//
+//   - TLS_CA_FILE: PEM bundle trusted in addition to the system roots
+//   - TLS_SERVER_NAME: SNI and verification name, for ILB IPs that have no
+//     DNS name of their own
+//   - TLS_INSECURE_SKIP_VERIFY: accept any certificate (the equivalent of
+//     curl -k); the chain is still reported
+//   - TLS_CLIENT_CERT, TLS_CLIENT_KEY: PEM client certificate for mTLS
+//   - TLS_MIN_VERSION: 1.0, 1.1, 1.2 (default) or 1.3
+func loadTLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName: os.Getenv("TLS_SERVER_NAME"),
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if f := os.Getenv("TLS_CA_FILE"); f != "" {
+		pem, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("TLS_CA_FILE: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("TLS_CA_FILE: no certificates found in %s", f)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if v := os.Getenv("TLS_INSECURE_SKIP_VERIFY"); v != "" {
+		skip, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("TLS_INSECURE_SKIP_VERIFY: %v", err)
+		}
+		cfg.InsecureSkipVerify = skip
+	}
+
+	certFile, keyFile := os.Getenv("TLS_CLIENT_CERT"), os.Getenv("TLS_CLIENT_KEY")
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("TLS_CLIENT_CERT and TLS_CLIENT_KEY must be set together")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if v := os.Getenv("TLS_MIN_VERSION"); v != "" {
+		versions := map[string]uint16{
+			"1.0": tls.VersionTLS10,
+			"1.1": tls.VersionTLS11,
+			"1.2": tls.VersionTLS12,
+			"1.3": tls.VersionTLS13,
+		}
+		version, ok := versions[v]
+		if !ok {
+			return nil, fmt.Errorf("TLS_MIN_VERSION %q (want 1.0, 1.1, 1.2 or 1.3)", v)
+		}
+		cfg.MinVersion = version
+	}
+	return cfg, nil
+}
+
+// newTransport returns a copy of http.DefaultTransport using the TLS_*
+// and proxy settings.
+func newTransport() (*http.Transport, error) {
+	cfg, err := loadTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = cfg
+	tr.Proxy = proxyFor
+	tr.OnProxyConnectResponse = checkProxyConnect
+	return tr, nil
+}
+
+// hostClients hands out one client per target Host so that, unless
+// TLS_SERVER_NAME pins a single name, each Host override is also the SNI
+// and verification name. A shared transport would send every row of a URL
+// map with the ILB IP as SNI and reuse one connection across hosts.
+type hostClients struct {
+	base    *http.Transport
+	clients map[string]*http.Client
+}
+
+func newHostClients(base *http.Transport) *hostClients {
+	return &hostClients{base: base, clients: map[string]*http.Client{}}
+}
+
+func (h *hostClients) client(host string) *http.Client {
+	if h.base.TLSClientConfig.ServerName != "" {
+		host = ""
+	}
+	if c, ok := h.clients[host]; ok {
+		return c
+	}
+	tr := h.base
+	if host != "" {
+		tr = h.base.Clone()
+		name := host
+		if hn, _, err := net.SplitHostPort(host); err == nil {
+			name = hn
+		}
+		tr.TLSClientConfig.ServerName = name
+	}
+	c := &http.Client{Transport: tracedTransport(tr)}
+	h.clients[host] = c
+	return c
+}
+
+// tlsState is the negotiated TLS session of one probe.
+type tlsState struct {
+	Version            string `json:"version,omitempty"`
+	CipherSuite        string `json:"cipher_suite,omitempty"`
+	NegotiatedProtocol string `json:"negotiated_protocol,omitempty"`
+	ServerName         string `json:"server_name,omitempty"`
+	Resumed            bool   `json:"resumed,omitempty"`
+	// Verified is false when the chain was accepted without verification
+	// (TLS_INSECURE_SKIP_VERIFY) or was rejected.
+	Verified bool       `json:"verified"`
+	Peer     []peerCert `json:"peer_certificates,omitempty"`
+}
+
+// peerCert describes one certificate in the chain the server presented,
+// leaf first.
+type peerCert struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	DNSNames  []string  `json:"dns_names,omitempty"`
+	IPs       []string  `json:"ip_addresses,omitempty"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	SHA256    string    `json:"sha256"`
+}
+
+func newTLSState(cs *tls.ConnectionState) *tlsState {
+	if cs == nil {
+		return nil
+	}
+	return &tlsState{
+		Version:            tls.VersionName(cs.Version),
+		CipherSuite:        tls.CipherSuiteName(cs.CipherSuite),
+		NegotiatedProtocol: cs.NegotiatedProtocol,
+		ServerName:         cs.ServerName,
+		Resumed:            cs.DidResume,
+		Verified:           len(cs.VerifiedChains) > 0,
+		Peer:               peerChain(cs.PeerCertificates),
+	}
+}
+
+// failedTLSState reports the chain a server presented when verification
+// rejected it, so a wrong CA or name can be diagnosed from the result.
+func failedTLSState(err error) *tlsState {
+	var certErr *tls.CertificateVerificationError
+	if !errors.As(err, &certErr) {
+		return nil
+	}
+	return &tlsState{Peer: peerChain(certErr.UnverifiedCertificates)}
+}
+
+func peerChain(certs []*x509.Certificate) []peerCert {
+	var chain []peerCert
+	for _, c := range certs {
+		sum := sha256.Sum256(c.Raw)
+		pc := peerCert{
+			Subject:   c.Subject.String(),
+			Issuer:    c.Issuer.String(),
+			DNSNames:  c.DNSNames,
+			NotBefore: c.NotBefore,
+			NotAfter:  c.NotAfter,
+			SHA256:    hex.EncodeToString(sum[:]),
+		}
+		for _, ip := range c.IPAddresses {
+			pc.IPs = append(pc.IPs, ip.String())
+		}
+		chain = append(chain, pc)
+	}
+	return chain
+}
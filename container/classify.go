@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// defaultSourceRanges mirrors the address plan created by the setup scripts.
+// Override with SOURCE_RANGES using the same name=cidr,name=cidr syntax; a
+// name may be repeated to cover several CIDRs.
+const defaultSourceRanges = "class-e-overlap=240.0.0.0/4," +
+	"proxy-only=241.0.0.0/18," +
+	"pnat=172.16.0.0/16," +
+	"connector=10.10.0.0/16," +
+	"hub-compute=10.0.0.0/28"
+
+const (
+	rangeUnknown = "unknown"
+	rangeInvalid = "invalid"
+)
+
+type namedRange struct {
+	Name   string
+	Prefix netip.Prefix
+}
+
+// rangeSet classifies addresses by longest-prefix match, so a narrower range
+// such as proxy-only wins over the enclosing class-e-overlap.
+type rangeSet []namedRange
+
+func parseRanges(spec string) (rangeSet, error) {
+	var rs rangeSet
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, cidr, ok := strings.Cut(entry, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("range %q: expected name=cidr", entry)
+		}
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("range %q: %v", entry, err)
+		}
+		rs = append(rs, namedRange{Name: strings.TrimSpace(name), Prefix: prefix.Masked()})
+	}
+	sort.SliceStable(rs, func(i, j int) bool {
+		return rs[i].Prefix.Bits() > rs[j].Prefix.Bits()
+	})
+	return rs, nil
+}
+
+// classification records which named range an address fell into.
+type classification struct {
+	IP    string `json:"ip"`
+	Range string `json:"range"`
+	CIDR  string `json:"cidr,omitempty"`
+}
+
+func (rs rangeSet) classify(ip string) classification {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return classification{IP: ip, Range: rangeInvalid}
+	}
+	addr = addr.Unmap()
+	for _, r := range rs {
+		if r.Prefix.Contains(addr) {
+			return classification{IP: ip, Range: r.Name, CIDR: r.Prefix.String()}
+		}
+	}
+	return classification{IP: ip, Range: rangeUnknown}
+}
+
+// sourceClassification is the verdict on where a request came from. Client is
+// the original requester: the first X-Forwarded-For hop when a proxy (Cloud
+// Run front end, ILB Envoy) added one, otherwise the remote peer.
+type sourceClassification struct {
+	Client       classification   `json:"client"`
+	Remote       classification   `json:"remote"`
+	ForwardedFor []classification `json:"forwarded_for"`
+}
+
+func (rs rangeSet) classifySource(remoteIP string, hops []string) sourceClassification {
+	sc := sourceClassification{
+		Remote:       rs.classify(remoteIP),
+		ForwardedFor: make([]classification, 0, len(hops)),
+	}
+	for _, hop := range hops {
+		sc.ForwardedFor = append(sc.ForwardedFor, rs.classify(hop))
+	}
+	sc.Client = sc.Remote
+	if len(sc.ForwardedFor) > 0 {
+		sc.Client = sc.ForwardedFor[0]
+	}
+	return sc
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	rs, err := parseRanges(defaultSourceRanges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ip, wantRange, wantCIDR string
+	}{
+		{"240.0.0.5", "class-e-overlap", "240.0.0.0/4"},
+		{"241.0.1.2", "proxy-only", "241.0.0.0/18"}, // inside class-e-overlap, narrower wins
+		{"241.0.64.1", "class-e-overlap", "240.0.0.0/4"},
+		{"172.16.3.4", "pnat", "172.16.0.0/16"},
+		{"10.10.0.7", "connector", "10.10.0.0/16"},
+		{"10.0.0.2", "hub-compute", "10.0.0.0/28"},
+		{"10.0.0.16", rangeUnknown, ""},
+		{"::ffff:172.16.0.9", "pnat", "172.16.0.0/16"},
+		{"::ffff:241.0.0.1", "proxy-only", "241.0.0.0/18"},
+		{"2001:db8::1", rangeUnknown, ""},
+		{"not-an-ip", rangeInvalid, ""},
+		{"", rangeInvalid, ""},
+	}
+	for _, tt := range tests {
+		got := rs.classify(tt.ip)
+		if got.IP != tt.ip || got.Range != tt.wantRange || got.CIDR != tt.wantCIDR {
+			t.Errorf("classify(%q) = %+v, want range %q cidr %q", tt.ip, got, tt.wantRange, tt.wantCIDR)
+		}
+	}
+}
+
+func TestParseRanges(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []string // name=cidr, longest prefix first
+		wantErr bool
+	}{
+		{spec: "", want: nil},
+		{spec: " a = 10.0.0.0/8 , b=10.1.0.0/16,", want: []string{"b=10.1.0.0/16", "a=10.0.0.0/8"}},
+		{spec: "wide=240.0.0.0/4,narrow=241.0.0.0/18", want: []string{"narrow=241.0.0.0/18", "wide=240.0.0.0/4"}},
+		{spec: "host=10.0.0.5/24", want: []string{"host=10.0.0.0/24"}},
+		{spec: "x=10.0.0.0/8,x=192.168.0.0/16", want: []string{"x=192.168.0.0/16", "x=10.0.0.0/8"}},
+		{spec: "10.0.0.0/8", wantErr: true},
+		{spec: "=10.0.0.0/8", wantErr: true},
+		{spec: "a=10.0.0.0", wantErr: true},
+		{spec: "a=10.0.0.0/33", wantErr: true},
+		{spec: "a=bogus/8", wantErr: true},
+	}
+	for _, tt := range tests {
+		rs, err := parseRanges(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseRanges(%q) = %v, want error", tt.spec, rs)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRanges(%q): %v", tt.spec, err)
+			continue
+		}
+		var got []string
+		for _, r := range rs {
+			got = append(got, r.Name+"="+r.Prefix.String())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("parseRanges(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestClassifySource(t *testing.T) {
+	rs, err := parseRanges(defaultSourceRanges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc := rs.classifySource("241.0.0.3", []string{"172.16.0.4", "241.0.0.3"})
+	if sc.Client.Range != "pnat" || sc.Remote.Range != "proxy-only" || len(sc.ForwardedFor) != 2 {
+		t.Errorf("with hops: %+v", sc)
+	}
+	sc = rs.classifySource("10.10.0.2", nil)
+	if sc.Client.Range != "connector" || sc.ForwardedFor == nil {
+		t.Errorf("without hops: %+v", sc)
+	}
+}
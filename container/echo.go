@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// echoSchemaVersion identifies the shape of echoResponse. Bump it whenever a
+// field is renamed or removed so test tooling can detect the change.
+const echoSchemaVersion = "v1"
+
+// instance describes the Cloud Run instance serving the request. It is read
+// once at startup from the environment Cloud Run injects.
+type instance struct {
+	Hostname      string `json:"hostname"`
+	Service       string `json:"service"`
+	Revision      string `json:"revision"`
+	Configuration string `json:"configuration"`
+}
+
+func loadInstance() instance {
+	hostname, _ := os.Hostname()
+	return instance{
+		Hostname:      hostname,
+		Service:       os.Getenv("K_SERVICE"),
+		Revision:      os.Getenv("K_REVISION"),
+		Configuration: os.Getenv("K_CONFIGURATION"),
+	}
+}
+
+// peer is the transport-level address the server observed for the client.
+type peer struct {
+	Address string `json:"address"`
+	IP      string `json:"ip"`
+	Port    string `json:"port"`
+}
+
+func newPeer(remoteAddr string) peer {
+	p := peer{Address: remoteAddr}
+	if host, port, err := net.SplitHostPort(remoteAddr); err == nil {
+		p.IP, p.Port = host, port
+	} else {
+		p.IP = remoteAddr
+	}
+	return p
+}
+
+type tlsInfo struct {
+	Enabled            bool   `json:"enabled"`
+	Version            string `json:"version,omitempty"`
+	CipherSuite        string `json:"cipher_suite,omitempty"`
+	ServerName         string `json:"server_name,omitempty"`
+	NegotiatedProtocol string `json:"negotiated_protocol,omitempty"`
+}
+
+func newTLSInfo(cs *tls.ConnectionState) tlsInfo {
+	if cs == nil {
+		return tlsInfo{}
+	}
+	return tlsInfo{
+		Enabled:            true,
+		Version:            tls.VersionName(cs.Version),
+		CipherSuite:        tls.CipherSuiteName(cs.CipherSuite),
+		ServerName:         cs.ServerName,
+		NegotiatedProtocol: cs.NegotiatedProtocol,
+	}
+}
+
+// echoResponse is the machine-readable counterpart of the plain-text reply.
+type echoResponse struct {
+	SchemaVersion string               `json:"schema_version"`
+	Instance      instance             `json:"instance"`
+	Remote        peer                 `json:"remote"`
+	ForwardedFor  []string             `json:"forwarded_for"`
+	Source        sourceClassification `json:"source"`
+	Method        string               `json:"method"`
+	Host          string               `json:"host"`
+	Path          string               `json:"path"`
+	Query         string               `json:"query,omitempty"`
+	Protocol      string               `json:"protocol"`
+	TLS           tlsInfo              `json:"tls"`
+	Headers       map[string][]string  `json:"headers"`
+}
+
+func (s *server) newEchoResponse(r *http.Request) echoResponse {
+	remote := newPeer(r.RemoteAddr)
+	hops := forwardedFor(r.Header)
+	return echoResponse{
+		SchemaVersion: echoSchemaVersion,
+		Instance:      s.inst,
+		Remote:        remote,
+		ForwardedFor:  hops,
+		Source:        s.ranges.classifySource(remote.IP, hops),
+		Method:        r.Method,
+		Host:          r.Host,
+		Path:          r.URL.Path,
+		Query:         r.URL.RawQuery,
+		Protocol:      r.Proto,
+		TLS:           newTLSInfo(r.TLS),
+		Headers:       r.Header,
+	}
+}
+
+// forwardedFor flattens every X-Forwarded-For header into a single ordered
+// list of hops, client first.
+func forwardedFor(h http.Header) []string {
+	hops := []string{}
+	for _, v := range h.Values("X-Forwarded-For") {
+		hops = append(hops, splitHops(v)...)
+	}
+	return hops
+}
+
+func splitHops(v string) []string {
+	var hops []string
+	for _, hop := range strings.Split(v, ",") {
+		if hop = strings.TrimSpace(hop); hop != "" {
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// wantsJSON reports whether the Accept header asks for application/json.
+func wantsJSON(r *http.Request) bool {
+	for _, v := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(v, ",") {
+			mt, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err == nil && mt == "application/json" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
@@ -0,0 +1,4 @@
+// Package echopb holds the generated gRPC bindings for echo.proto.
+package echopb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative echo.proto
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Upper bounds for the fault-injection endpoints. Cloud Run's request
+// timeout tops out at 60 minutes, so longer delays are never useful.
+const (
+	maxDelay = 60 * time.Minute
+	maxBytes = 1 << 30
+	maxDrip  = 10 << 20
+	// maxUpload matches Cloud Run's 32 MiB limit on HTTP/1 request bodies.
+	maxUpload = 32 << 20
+)
+
+// parseDelay accepts a Go duration ("1500ms") or a number of seconds ("1.5").
+func parseDelay(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		secs, ferr := strconv.ParseFloat(v, 64)
+		if ferr != nil {
+			return 0, fmt.Errorf("invalid duration %q", v)
+		}
+		d = time.Duration(secs * float64(time.Second))
+	}
+	if d < 0 || d > maxDelay {
+		return 0, fmt.Errorf("duration %s out of range (0-%s)", d, maxDelay)
+	}
+	return d, nil
+}
+
+// sleepCtx waits for d or until the client goes away.
+func sleepCtx(r *http.Request, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// handleStatus replies with the requested status code.
+func (s *server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	code, err := strconv.Atoi(r.PathValue("code"))
+	if err != nil || code < 200 || code > 599 {
+		http.Error(w, "status code must be 200-599", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, "%d %s\nHostname: %s\n", code, http.StatusText(code), s.inst.Hostname)
+}
+
+// handleDelay waits before answering with the JSON echo.
+func (s *server) handleDelay(w http.ResponseWriter, r *http.Request) {
+	d, err := parseDelay(r.PathValue("duration"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !sleepCtx(r, d) {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.newEchoResponse(r))
+}
+
+// handleBytes returns n pseudo-random bytes. ?seed= makes the body
+// reproducible so a client can compare checksums.
+func (s *server) handleBytes(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.ParseInt(r.PathValue("n"), 10, 64)
+	if err != nil || n < 0 || n > maxBytes {
+		http.Error(w, fmt.Sprintf("n must be 0-%d", maxBytes), http.StatusBadRequest)
+		return
+	}
+	seed, _ := strconv.ParseUint(r.URL.Query().Get("seed"), 10, 64)
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	var key [32]byte
+	for i := range 8 {
+		key[i] = byte(seed >> (8 * i))
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+	io.CopyN(w, rand.NewChaCha8(key), n)
+}
+
+// uploadReply lets a client confirm a request body arrived intact.
+type uploadReply struct {
+	Instance instance `json:"instance"`
+	Bytes    int64    `json:"bytes"`
+	SHA256   string   `json:"sha256"`
+}
+
+// handleUpload reads the request body and answers with its size and
+// SHA-256, for large-payload and path-MTU probes.
+func (s *server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	h := sha256.New()
+	n, err := io.Copy(h, http.MaxBytesReader(w, r.Body, maxUpload))
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	writeJSON(w, http.StatusOK, uploadReply{
+		Instance: s.inst,
+		Bytes:    n,
+		SHA256:   hex.EncodeToString(h.Sum(nil)),
+	})
+}
+
+// handleDrip writes numbytes bytes spread evenly over duration, after an
+// initial delay, to simulate a slow upstream.
+func (s *server) handleDrip(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	numBytes := 10
+	if v := q.Get("numbytes"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxDrip {
+			http.Error(w, fmt.Sprintf("numbytes must be 1-%d", maxDrip), http.StatusBadRequest)
+			return
+		}
+		numBytes = n
+	}
+	duration, delay := 2*time.Second, time.Duration(0)
+	var err error
+	if v := q.Get("duration"); v != "" {
+		if duration, err = parseDelay(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("delay"); v != "" {
+		if delay, err = parseDelay(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	code := http.StatusOK
+	if v := q.Get("code"); v != "" {
+		if code, err = strconv.Atoi(v); err != nil || code < 200 || code > 599 {
+			http.Error(w, "code must be 200-599", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !sleepCtx(r, delay) {
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(numBytes))
+	w.WriteHeader(code)
+	interval := duration / time.Duration(numBytes)
+	for i := range numBytes {
+		if i > 0 && !sleepCtx(r, interval) {
+			return
+		}
+		if _, err := w.Write([]byte{'*'}); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// handleRedirect redirects n times before landing on /echo.
+func (s *server) handleRedirect(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil || n < 1 || n > 100 {
+		http.Error(w, "n must be 1-100", http.StatusBadRequest)
+		return
+	}
+	target := "/echo"
+	if n > 1 {
+		target = fmt.Sprintf("/redirect/%d", n-1)
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// handleHeaders echoes only the request headers.
+func (s *server) handleHeaders(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"headers": r.Header})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	grpcpeer "google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+
+	"github.com/pmgledhill102/cloud-run-overlap-ips-with-nat/container/echopb"
+)
+
+// newGRPCServer registers the Echo service, grpc.health.v1 and server
+// reflection. It is served through net/http (see grpcHandler), so the same
+// $PORT answers both HTTP/1.1 and h2c gRPC.
+func (s *server) newGRPCServer() *grpc.Server {
+	gs := grpc.NewServer()
+	echopb.RegisterEchoServiceServer(gs, &echoService{s: s})
+
+	// Serving status is driven by setReady.
+	s.health = health.NewServer()
+	healthpb.RegisterHealthServer(gs, s.health)
+
+	reflection.Register(gs)
+
+	s.grpcMethods = make(map[string]bool)
+	for name, info := range gs.GetServiceInfo() {
+		for _, m := range info.Methods {
+			s.grpcMethods["/"+name+"/"+m.Name] = true
+		}
+	}
+	return gs
+}
+
+// isGRPC reports whether r is a gRPC call rather than plain HTTP.
+func isGRPC(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// grpcHandler routes HTTP/2 requests with a gRPC content type to gs and
+// everything else to next.
+func grpcHandler(gs *grpc.Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isGRPC(r) {
+			gs.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type echoService struct {
+	echopb.UnimplementedEchoServiceServer
+	s *server
+}
+
+func (e *echoService) Echo(ctx context.Context, req *echopb.EchoRequest) (*echopb.EchoResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var remote peer
+	tlsEnabled := false
+	if p, ok := grpcpeer.FromContext(ctx); ok {
+		remote = newPeer(p.Addr.String())
+		if _, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			tlsEnabled = true
+		}
+	}
+
+	var hops []string
+	for _, v := range md.Get("x-forwarded-for") {
+		hops = append(hops, splitHops(v)...)
+	}
+	if hops == nil {
+		hops = []string{}
+	}
+
+	method, _ := grpc.Method(ctx)
+	authority := ""
+	if v := md.Get(":authority"); len(v) > 0 {
+		authority = v[0]
+	}
+
+	flat := make(map[string]string, len(md))
+	for k, v := range md {
+		flat[k] = strings.Join(v, ", ")
+	}
+
+	src := e.s.ranges.classifySource(remote.IP, hops)
+	return &echopb.EchoResponse{
+		SchemaVersion: echoSchemaVersion,
+		Instance: &echopb.Instance{
+			Hostname:      e.s.inst.Hostname,
+			Service:       e.s.inst.Service,
+			Revision:      e.s.inst.Revision,
+			Configuration: e.s.inst.Configuration,
+		},
+		Remote:       &echopb.Peer{Address: remote.Address, Ip: remote.IP, Port: remote.Port},
+		ForwardedFor: hops,
+		Source: &echopb.SourceClassification{
+			Client:       classificationPB(src.Client),
+			Remote:       classificationPB(src.Remote),
+			ForwardedFor: classificationsPB(src.ForwardedFor),
+		},
+		Method:    method,
+		Authority: authority,
+		Protocol:  "HTTP/2.0",
+		Tls:       tlsEnabled,
+		Metadata:  flat,
+		Message:   req.GetMessage(),
+	}, nil
+}
+
+func classificationPB(c classification) *echopb.Classification {
+	return &echopb.Classification{Ip: c.IP, Range: c.Range, Cidr: c.CIDR}
+}
+
+func classificationsPB(cs []classification) []*echopb.Classification {
+	out := make([]*echopb.Classification, 0, len(cs))
+	for _, c := range cs {
+		out = append(out, classificationPB(c))
+	}
+	return out
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/pmgledhill102/cloud-run-overlap-ips-with-nat/container/echopb"
+)
+
+// setReady flips /readyz and the grpc.health.v1 status together, so HTTP
+// and gRPC health checks always agree.
+func (s *server) setReady(ready bool) {
+	s.ready.Store(ready)
+	status := healthpb.HealthCheckResponse_SERVING
+	if !ready {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	s.health.SetServingStatus("", status)
+	s.health.SetServingStatus(echopb.EchoService_ServiceDesc.ServiceName, status)
+}
+
+// handleHealthz is the liveness probe: it succeeds while the process runs.
+func (s *server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "ok\nHostname: %s\n", s.inst.Hostname)
+}
+
+// handleReadyz is the readiness probe. POST /readyz?ready=false (or true)
+// flips it at runtime; it also goes unready when shutdown starts.
+func (s *server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		ready, err := strconv.ParseBool(r.URL.Query().Get("ready"))
+		if err != nil {
+			http.Error(w, "ready must be true or false", http.StatusBadRequest)
+			return
+		}
+		s.setReady(ready)
+		requestLogger(r).Info("Readiness changed", "ready", ready, "by", r.RemoteAddr)
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	if !s.ready.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "not ready\nHostname: %s\n", s.inst.Hostname)
+		return
+	}
+	fmt.Fprintf(w, "ready\nHostname: %s\n", s.inst.Hostname)
+}
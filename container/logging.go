@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Cloud Logging reads these keys from JSON written to stdout/stderr.
+// https://cloud.google.com/logging/docs/structured-logging
+const (
+	traceKey        = "logging.googleapis.com/trace"
+	spanIDKey       = "logging.googleapis.com/spanId"
+	traceSampledKey = "logging.googleapis.com/trace_sampled"
+)
+
+// traceProject prefixes trace IDs so Cloud Logging can link entries to
+// Cloud Trace. It is set once at startup by setupLogging.
+var traceProject string
+
+// setupLogging installs a JSON slog handler using Cloud Logging's field
+// names (severity, message) as the default logger.
+func setupLogging() {
+	traceProject = projectID()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) > 0 {
+				return a
+			}
+			switch a.Key {
+			case slog.LevelKey:
+				return slog.String("severity", severity(a.Value.Any().(slog.Level)))
+			case slog.MessageKey:
+				a.Key = "message"
+			}
+			return a
+		},
+	})))
+}
+
+func severity(l slog.Level) string {
+	switch {
+	case l >= slog.LevelError:
+		return "ERROR"
+	case l >= slog.LevelWarn:
+		return "WARNING"
+	case l >= slog.LevelInfo:
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
+
+// projectID returns GOOGLE_CLOUD_PROJECT, falling back to the metadata
+// server. It returns "" off Google Cloud.
+func projectID() string {
+	if p := os.Getenv("GOOGLE_CLOUD_PROJECT"); p != "" {
+		return p
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet,
+		"http://metadata.google.internal/computeMetadata/v1/project/project-id", nil)
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+	b, _ := io.ReadAll(resp.Body)
+	return strings.TrimSpace(string(b))
+}
+
+// traceAttrs returns the trace context for r's log entries: the server span
+// started by traced, or on untraced routes whatever traceparent or
+// X-Cloud-Trace-Context the caller sent.
+func traceAttrs(r *http.Request) []any {
+	sc := trace.SpanContextFromContext(r.Context())
+	if !sc.IsValid() {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		sc = trace.SpanContextFromContext(ctx)
+	}
+	if !sc.IsValid() {
+		return nil
+	}
+	traceID := sc.TraceID().String()
+	if traceProject != "" {
+		traceID = "projects/" + traceProject + "/traces/" + traceID
+	}
+	return []any{
+		slog.String(traceKey, traceID),
+		slog.String(spanIDKey, sc.SpanID().String()),
+		slog.Bool(traceSampledKey, sc.IsSampled()),
+	}
+}
+
+// requestLogger returns a logger carrying r's trace context.
+func requestLogger(r *http.Request) *slog.Logger {
+	return slog.With(traceAttrs(r)...)
+}
+
+// httpRequestAttr builds Cloud Logging's httpRequest object.
+func httpRequestAttr(r *http.Request, status int, size int64, latency time.Duration) slog.Attr {
+	return slog.Group("httpRequest",
+		slog.String("requestMethod", r.Method),
+		slog.String("requestUrl", r.URL.String()),
+		slog.Int("status", status),
+		slog.Int64("responseSize", size),
+		slog.String("userAgent", r.UserAgent()),
+		slog.String("remoteIp", newPeer(r.RemoteAddr).IP),
+		slog.String("referer", r.Referer()),
+		slog.String("latency", latencyString(latency)),
+		slog.String("protocol", r.Proto),
+	)
+}
+
+// latencyString formats d the way Cloud Logging expects ("0.123456s").
+func latencyString(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 6, 64) + "s"
+}
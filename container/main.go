@@ -1,28 +1,201 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc/health"
 )
 
+// server holds the per-instance state shared by all handlers.
+type server struct {
+	inst   instance
+	ranges rangeSet
+	health *health.Server
+	ready  atomic.Bool
+
+	// grpcMethods holds the full names ("/pkg.Service/Method") of every
+	// registered gRPC method, for the metrics path label.
+	grpcMethods map[string]bool
+
+	// stopping is closed once the drain period ends, telling /sse and /ws
+	// to send a final close event.
+	stopping chan struct{}
+}
+
 func main() {
+	setupLogging()
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
-	hostname, _ := os.Hostname()
+	rangeSpec := os.Getenv("SOURCE_RANGES")
+	if rangeSpec == "" {
+		rangeSpec = defaultSourceRanges
+	}
+	ranges, err := parseRanges(rangeSpec)
+	if err != nil {
+		slog.Error("Invalid SOURCE_RANGES", "error", err)
+		os.Exit(1)
+	}
+
+	// Cloud Run sends SIGTERM and allows 10s before SIGKILL. DRAIN_PERIOD is
+	// how long to stay up but unready so the NEG/ILB can stop routing here;
+	// SHUTDOWN_TIMEOUT bounds waiting for in-flight requests afterwards.
+	drainPeriod, err := envDuration("DRAIN_PERIOD", 5*time.Second)
+	if err != nil {
+		slog.Error("Invalid DRAIN_PERIOD", "error", err)
+		os.Exit(1)
+	}
+	shutdownTimeout, err := envDuration("SHUTDOWN_TIMEOUT", 4*time.Second)
+	if err != nil {
+		slog.Error("Invalid SHUTDOWN_TIMEOUT", "error", err)
+		os.Exit(1)
+	}
+
+	s := &server{inst: loadInstance(), ranges: ranges, stopping: make(chan struct{})}
+	shutdownTracing, err := setupTracing(context.Background(), s.inst)
+	if err != nil {
+		slog.Error("Tracing setup failed", "error", err)
+		os.Exit(1)
+	}
+	gs := s.newGRPCServer()
+	s.setReady(true)
+	s.recordStart(time.Now())
+
+	mux := http.NewServeMux()
+	// /echo always answers with JSON; / keeps the plain-text reply unless the
+	// client asks for JSON via the Accept header.
+	mux.HandleFunc("/echo", s.handleEcho)
+	mux.HandleFunc("/", s.handleRoot)
+
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.Handle("/metrics", promhttp.Handler())
+
+	mux.HandleFunc("/sse", s.handleSSE)
+	mux.HandleFunc("/ws", s.handleWS)
+
+	// httpbin-style fault injection.
+	mux.HandleFunc("/status/{code}", s.handleStatus)
+	mux.HandleFunc("/delay/{duration}", s.handleDelay)
+	mux.HandleFunc("/bytes/{n}", s.handleBytes)
+	mux.HandleFunc("POST /upload", s.handleUpload)
+	mux.HandleFunc("/drip", s.handleDrip)
+	mux.HandleFunc("/redirect/{n}", s.handleRedirect)
+	mux.HandleFunc("/headers", s.handleHeaders)
+
+	// HTTP/1.1 and h2c share the port: Cloud Run with --use-http2 and the
+	// ILB's HTTP/2 backends send gRPC as cleartext HTTP/2.
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	// Cancelling baseCtx ends whatever is still running when
+	// SHUTDOWN_TIMEOUT expires, such as long gRPC streams and delays.
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	srv := &http.Server{
+		Addr:        ":" + port,
+		Handler:     traced(s.instrument(grpcHandler(gs, mux))),
+		Protocols:   &protocols,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
+
+	// Optional raw listeners for non-HTTP NAT tests. Cloud Run only routes
+	// $PORT, so these are for the hub VM or other hosts that expose them.
+	if p := os.Getenv("TCP_ECHO_PORT"); p != "" {
+		go func() {
+			if err := s.serveTCPEcho(p); err != nil {
+				slog.Error("TCP echo error", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+	if p := os.Getenv("UDP_ECHO_PORT"); p != "" {
+		go func() {
+			if err := s.serveUDPEcho(p); err != nil {
+				slog.Error("UDP echo error", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	sigCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/plain")
-		fmt.Fprintf(w, "OK\nHostname: %s\nService: %s\nRequester: %s\n",
-			hostname, os.Getenv("K_SERVICE"), r.RemoteAddr)
-	})
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Listening (HTTP/1.1, h2c gRPC)", "port", port)
+		serveErr <- srv.ListenAndServe()
+	}()
 
-	fmt.Printf("Listening on port %s\n", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
+	select {
+	case err := <-serveErr:
+		slog.Error("Server error", "error", err)
 		os.Exit(1)
+	case <-sigCtx.Done():
+	}
+
+	start := time.Now()
+	s.setReady(false)
+	slog.Info("Shutdown signal received; draining", "drainPeriod", drainPeriod.String())
+	time.Sleep(drainPeriod)
+
+	// /sse and /ws send their close event and end; Shutdown then waits
+	// for the other in-flight requests to complete. Any still running at
+	// the deadline are cancelled and their connections closed, so the
+	// client sees an error rather than an empty 200.
+	close(s.stopping)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn("Shutdown timeout reached; closing remaining connections", "shutdownTimeout", shutdownTimeout.String())
+		srv.Close()
+		cancelRequests()
+	} else if err != nil {
+		slog.Error("Shutdown error", "error", err)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("Trace flush error", "error", err)
+	}
+	slog.Info("Shutdown complete", "durationSeconds", time.Since(start).Seconds())
+}
+
+// envDuration parses key as a Go duration, returning def when it is unset.
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	return time.ParseDuration(v)
+}
+
+func (s *server) handleEcho(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.newEchoResponse(r))
+}
+
+func (s *server) handleRoot(w http.ResponseWriter, r *http.Request) {
+	if wantsJSON(r) {
+		s.handleEcho(w, r)
+		return
+	}
+	src := s.ranges.classifySource(newPeer(r.RemoteAddr).IP, forwardedFor(r.Header))
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "OK\nHostname: %s\nService: %s\nRequester: %s\nSource range: %s\n",
+		s.inst.Hostname, s.inst.Service, r.RemoteAddr, src.Client.Range)
+	for _, hop := range src.ForwardedFor {
+		fmt.Fprintf(w, "Forwarded-For: %s (%s)\n", hop.IP, hop.Range)
 	}
 }
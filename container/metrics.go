@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc/codes"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "echo_http_requests_total",
+		Help: "HTTP and gRPC requests by route, status code (HTTP status, or gRPC status name) and classified source range.",
+	}, []string{"path", "code", "source_range"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "echo_http_request_duration_seconds",
+		Help:    "Request latency by route and classified source range.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"path", "source_range"})
+
+	requestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "echo_http_requests_in_flight",
+		Help: "Requests currently being served, including open /sse and /ws streams.",
+	})
+
+	instanceStart = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "echo_instance_start_timestamp_seconds",
+		Help: "Unix time the instance started, labelled with its identity.",
+	}, []string{"hostname", "service", "revision"})
+)
+
+// recordStart publishes the instance start time.
+func (s *server) recordStart(t time.Time) {
+	instanceStart.WithLabelValues(s.inst.Hostname, s.inst.Service, s.inst.Revision).
+		Set(float64(t.UnixNano()) / 1e9)
+}
+
+// instrument records request metrics and writes an access log entry. It
+// wraps the gRPC/mux router so the path label is the matched mux pattern or
+// a registered gRPC method, which keeps label cardinality bounded for
+// routes like /bytes/{n} and for arbitrary gRPC paths. For gRPC the code
+// label is the grpc-status name, since the HTTP status is 200 even when
+// the call fails.
+func (s *server) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestsInFlight.Inc()
+		defer requestsInFlight.Dec()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		path, code := r.Pattern, strconv.Itoa(rec.status)
+		if isGRPC(r) {
+			path = "grpc_unknown"
+			if s.grpcMethods[r.URL.Path] {
+				path = r.URL.Path
+			}
+			if v := rec.Header().Get("Grpc-Status"); v != "" {
+				code = grpcStatusName(v)
+			}
+		}
+		if path == "" {
+			path = "unmatched"
+		}
+		src := s.ranges.classifySource(newPeer(r.RemoteAddr).IP, forwardedFor(r.Header)).Client.Range
+		requestsTotal.WithLabelValues(path, code, src).Inc()
+		latency := time.Since(start)
+		requestDuration.WithLabelValues(path, src).Observe(latency.Seconds())
+
+		requestLogger(r).Info(r.Method+" "+r.URL.Path,
+			httpRequestAttr(r, rec.status, rec.size, latency),
+			slog.String("route", path),
+			slog.String("sourceRange", src))
+	})
+}
+
+// grpcStatusName maps a grpc-status trailer value to its code name, e.g.
+// "0" to "OK". Unparseable values become "Unknown".
+func grpcStatusName(v string) string {
+	n, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return codes.Unknown.String()
+	}
+	return codes.Code(n).String()
+}
+
+// statusRecorder captures the response status and size while still exposing the
+// Flusher and Hijacker that gRPC, /sse and /ws depend on.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status, r.wroteHeader = code, true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *statusRecorder) Flush() {
+	r.wroteHeader = true
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+	r.status, r.wroteHeader = http.StatusSwitchingProtocols, true
+	return h.Hijack()
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
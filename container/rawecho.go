@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// rawEchoIdleTimeout closes TCP echo connections that send nothing for this
+// long, so abandoned flows don't pin the instance.
+const rawEchoIdleTimeout = 5 * time.Minute
+
+// maxDatagram is the largest UDP payload the echo listener reads or
+// writes.
+const maxDatagram = 65507
+
+// rawEchoReply is written back for every TCP line or UDP datagram received.
+type rawEchoReply struct {
+	Protocol string         `json:"protocol"`
+	Instance instance       `json:"instance"`
+	Remote   peer           `json:"remote"`
+	Source   classification `json:"source"`
+	Bytes    int            `json:"bytes"`
+	Payload  string         `json:"payload"`
+	// PayloadOmitted is set when echoing the payload would make the reply
+	// larger than maxLen, e.g. a UDP datagram close to maxDatagram.
+	PayloadOmitted bool `json:"payload_omitted,omitempty"`
+}
+
+// rawEchoReply encodes the reply to payload as one JSON line. With maxLen
+// above zero, a reply that would exceed it leaves the payload out so the
+// sender still gets an answer.
+func (s *server) rawEchoReply(protocol string, addr net.Addr, payload []byte, maxLen int) []byte {
+	remote := newPeer(addr.String())
+	reply := rawEchoReply{
+		Protocol: protocol,
+		Instance: s.inst,
+		Remote:   remote,
+		Source:   s.ranges.classify(remote.IP),
+		Bytes:    len(payload),
+		Payload:  string(payload),
+	}
+	b, _ := json.Marshal(reply)
+	if maxLen > 0 && len(b)+1 > maxLen {
+		reply.Payload, reply.PayloadOmitted = "", true
+		b, _ = json.Marshal(reply)
+	}
+	return append(b, '\n')
+}
+
+// serveTCPEcho answers each newline-terminated line with a JSON reply.
+func (s *server) serveTCPEcho(port string) error {
+	ln, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
+	}
+	slog.Info("TCP echo listening", "port", port)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleTCPEcho(conn)
+	}
+}
+
+func (s *server) handleTCPEcho(conn net.Conn) {
+	defer conn.Close()
+	sc := bufio.NewScanner(conn)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for {
+		conn.SetReadDeadline(time.Now().Add(rawEchoIdleTimeout))
+		if !sc.Scan() {
+			return
+		}
+		if _, err := conn.Write(s.rawEchoReply("tcp", conn.RemoteAddr(), sc.Bytes(), 0)); err != nil {
+			return
+		}
+	}
+}
+
+// serveUDPEcho answers each datagram with a JSON reply to its sender.
+func (s *server) serveUDPEcho(port string) error {
+	pc, err := net.ListenPacket("udp", ":"+port)
+	if err != nil {
+		return err
+	}
+	slog.Info("UDP echo listening", "port", port)
+	buf := make([]byte, maxDatagram)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		if _, err := pc.WriteTo(s.rawEchoReply("udp", addr, buf[:n], maxDatagram), addr); err != nil {
+			slog.Warn("UDP echo write failed", "peer", addr.String(), "error", err)
+		}
+	}
+}
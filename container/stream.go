@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const defaultHeartbeatInterval = 5 * time.Second
+
+// heartbeat is sent periodically on /ws and /sse. ConnectedSeconds tells the
+// client how long the flow has survived so far; the final event (type
+// "close") is sent when the server ends the stream because max was reached
+// or the instance is shutting down.
+type heartbeat struct {
+	Type             string    `json:"type"`
+	Seq              int       `json:"seq"`
+	Time             time.Time `json:"time"`
+	ConnectedSeconds float64   `json:"connected_seconds"`
+	Instance         instance  `json:"instance"`
+	Remote           peer      `json:"remote"`
+	Message          string    `json:"message,omitempty"`
+}
+
+// streamParams reads ?interval= (heartbeat period) and ?max= (stream
+// lifetime, 0 for unlimited) from the request.
+func streamParams(r *http.Request) (interval, max time.Duration, err error) {
+	interval = defaultHeartbeatInterval
+	if v := r.URL.Query().Get("interval"); v != "" {
+		if interval, err = time.ParseDuration(v); err != nil || interval <= 0 {
+			return 0, 0, fmt.Errorf("invalid interval %q", v)
+		}
+	}
+	if v := r.URL.Query().Get("max"); v != "" {
+		if max, err = time.ParseDuration(v); err != nil || max < 0 {
+			return 0, 0, fmt.Errorf("invalid max %q", v)
+		}
+	}
+	return interval, max, nil
+}
+
+// maxTimer returns a channel that fires after max, or never when max is 0.
+func maxTimer(max time.Duration) (<-chan time.Time, func()) {
+	if max == 0 {
+		return nil, func() {}
+	}
+	t := time.NewTimer(max)
+	return t.C, func() { t.Stop() }
+}
+
+func (s *server) newHeartbeat(typ string, seq int, start time.Time, r *http.Request) heartbeat {
+	return heartbeat{
+		Type:             typ,
+		Seq:              seq,
+		Time:             time.Now().UTC(),
+		ConnectedSeconds: time.Since(start).Seconds(),
+		Instance:         s.inst,
+		Remote:           newPeer(r.RemoteAddr),
+	}
+}
+
+// handleSSE streams heartbeat events until the client disconnects or max
+// elapses.
+func (s *server) handleSSE(w http.ResponseWriter, r *http.Request) {
+	interval, max, err := streamParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	start := time.Now()
+	send := func(hb heartbeat) {
+		b, _ := json.Marshal(hb)
+		fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", hb.Seq, hb.Type, b)
+		flusher.Flush()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	done, stop := maxTimer(max)
+	defer stop()
+
+	seq := 0
+	send(s.newHeartbeat("open", seq, start, r))
+	for {
+		select {
+		case <-ticker.C:
+			seq++
+			send(s.newHeartbeat("heartbeat", seq, start, r))
+		case <-done:
+			seq++
+			send(s.newHeartbeat("close", seq, start, r))
+			logStreamEnd(r, "sse", "max", start, nil)
+			return
+		case <-s.stopping:
+			seq++
+			send(s.newHeartbeat("close", seq, start, r))
+			logStreamEnd(r, "sse", "shutdown", start, nil)
+			return
+		case <-r.Context().Done():
+			logStreamEnd(r, "sse", "client", start, nil)
+			return
+		}
+	}
+}
+
+// logStreamEnd records how long a /sse or /ws connection survived and which
+// side ended it.
+func logStreamEnd(r *http.Request, kind, closedBy string, start time.Time, err error) {
+	attrs := []any{
+		"stream", kind,
+		"closedBy", closedBy,
+		"remote", r.RemoteAddr,
+		"durationSeconds", time.Since(start).Seconds(),
+	}
+	if err != nil {
+		attrs = append(attrs, "error", err.Error())
+	}
+	requestLogger(r).Info("Stream closed", attrs...)
+}
+
+var upgrader = websocket.Upgrader{
+	// The PoC is reached by IP from the hub VM and jobs, not from browsers.
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// handleWS sends heartbeat messages until either side closes or max
+// elapses. Text messages from the client are echoed back as type "echo".
+func (s *server) handleWS(w http.ResponseWriter, r *http.Request) {
+	interval, max, err := streamParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	incoming := make(chan string)
+	readErr := make(chan error, 1)
+	quit := make(chan struct{})
+	defer close(quit)
+	go func() {
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case incoming <- string(msg):
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	done, stop := maxTimer(max)
+	defer stop()
+
+	seq := 0
+	send := func(hb heartbeat) error {
+		conn.SetWriteDeadline(time.Now().Add(interval))
+		return conn.WriteJSON(hb)
+	}
+	if err := send(s.newHeartbeat("open", seq, start, r)); err != nil {
+		return
+	}
+	for {
+		var err error
+		select {
+		case <-ticker.C:
+			seq++
+			err = send(s.newHeartbeat("heartbeat", seq, start, r))
+		case msg := <-incoming:
+			seq++
+			hb := s.newHeartbeat("echo", seq, start, r)
+			hb.Message = msg
+			err = send(hb)
+		case <-done:
+			seq++
+			send(s.newHeartbeat("close", seq, start, r))
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, "max reached"),
+				time.Now().Add(time.Second))
+			logStreamEnd(r, "ws", "max", start, nil)
+			return
+		case <-s.stopping:
+			seq++
+			send(s.newHeartbeat("close", seq, start, r))
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(time.Second))
+			logStreamEnd(r, "ws", "shutdown", start, nil)
+			return
+		case rerr := <-readErr:
+			logStreamEnd(r, "ws", "client", start, rerr)
+			return
+		}
+		if err != nil {
+			logStreamEnd(r, "ws", "write-error", start, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// setupTracing installs a global TracerProvider and propagators for W3C
+// trace context and X-Cloud-Trace-Context; traceparent wins when a request
+// carries both. Spans are exported over OTLP/HTTP when
+// OTEL_EXPORTER_OTLP_ENDPOINT (or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT) is set,
+// e.g. http://collector:4318. Without an endpoint spans are still created so
+// trace IDs propagate and reach the logs, but nothing is exported.
+func setupTracing(ctx context.Context, inst instance) (func(context.Context) error, error) {
+	name := inst.Service
+	if name == "" {
+		name = "echo-server"
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			attribute.String("service.name", name),
+			attribute.String("service.version", inst.Revision),
+			attribute.String("service.instance.id", inst.Hostname),
+		),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+		exp, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp))
+	}
+	tp := sdktrace.NewTracerProvider(opts...)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		cloudTracePropagator{}, propagation.TraceContext{}, propagation.Baggage{}))
+	return tp.Shutdown, nil
+}
+
+// cloudTraceHeader is Google's own trace header, "TRACE_ID/SPAN_ID;o=1",
+// with a hex trace ID and a decimal span ID.
+const cloudTraceHeader = "X-Cloud-Trace-Context"
+
+// cloudTracePropagator extracts X-Cloud-Trace-Context, so a caller that
+// sends only that header still gets its trace ID in the logs. It injects
+// nothing: outbound requests carry traceparent.
+type cloudTracePropagator struct{}
+
+func (cloudTracePropagator) Inject(context.Context, propagation.TextMapCarrier) {}
+
+func (cloudTracePropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	sc, ok := parseCloudTrace(carrier.Get(cloudTraceHeader))
+	if !ok {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+func (cloudTracePropagator) Fields() []string {
+	return []string{cloudTraceHeader}
+}
+
+func parseCloudTrace(v string) (trace.SpanContext, bool) {
+	ids, opts, _ := strings.Cut(v, ";")
+	tid, sid, _ := strings.Cut(ids, "/")
+	traceID, err := trace.TraceIDFromHex(strings.ToLower(tid))
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	n, err := strconv.ParseUint(sid, 10, 64)
+	if err != nil || n == 0 {
+		return trace.SpanContext{}, false
+	}
+	var spanID trace.SpanID
+	binary.BigEndian.PutUint64(spanID[:], n)
+	var flags trace.TraceFlags
+	if opts == "o=1" {
+		flags = trace.FlagsSampled
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: flags,
+		Remote:     true,
+	}), true
+}
+
+// traced extracts the incoming trace context and wraps each request
+// in a server span that is a child of the caller's. Probe and scrape
+// endpoints are left untraced.
+func traced(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "server",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		}),
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			switch r.URL.Path {
+			case "/metrics", "/healthz", "/readyz":
+				return false
+			}
+			return true
+		}),
+	)
+}